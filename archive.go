@@ -0,0 +1,173 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/qor/i18n"
+)
+
+// ArchiveYear is a year of the archive of the website, with the number of pages published in it and its months.
+// Path is that of its category, like `/archive/2018/`.
+type ArchiveYear struct {
+	Year   int
+	Name   string
+	Path   string
+	Count  int
+	Months []ArchiveMonth
+}
+
+// ArchiveMonth is a month of the archive of the website, with the number of pages published in it.
+// Path is that of its category, like `/archive/2018/05/`.
+type ArchiveMonth struct {
+	Month time.Month
+	Name  string
+	Path  string
+	Count int
+}
+
+// pageMonth returns the year and month a page was published in, or false if it has no date.
+// Index pages are not archived.
+func pageMonth(page *Page) (year int, month time.Month, ok bool) {
+	if page.IsIndex() {
+		return 0, 0, false
+	}
+	if page.Date.IsZero() {
+		return 0, 0, false
+	}
+	return page.Date.Year(), page.Date.Month(), true
+}
+
+// newArchiveCategory makes the virtual `archive` category of tree, with a subcategory for each year and month
+// in which pages were published, most recent first. It returns nil if no page has a date.
+func newArchiveCategory(tree *Category, siteinfo Siteinfo, locales *i18n.I18n) *Category {
+	// group pages by month
+	type yearMonth struct {
+		year  int
+		month time.Month
+	}
+	pages := make(map[yearMonth]map[string][]*Page)
+	for locale := range siteinfo.Locales {
+		for _, page := range tree.RecentPages(-1, locale) {
+			year, month, ok := pageMonth(page)
+			if !ok {
+				continue
+			}
+			ym := yearMonth{year, month}
+			if pages[ym] == nil {
+				pages[ym] = make(map[string][]*Page)
+			}
+			pages[ym][locale] = append(pages[ym][locale], page)
+		}
+	}
+	if len(pages) == 0 {
+		return nil
+	}
+	var months []yearMonth
+	for ym := range pages {
+		months = append(months, ym)
+	}
+	sort.Slice(months, func(i, j int) bool {
+		if months[i].year != months[j].year {
+			return months[i].year > months[j].year
+		}
+		return months[i].month > months[j].month
+	})
+
+	archiveCat := NewCategory(siteinfo)
+	archiveCat.Parent = tree
+	archiveCat.Virtual = true
+	for locale := range siteinfo.Locales {
+		archiveCat.Locales[locale].Basename = "archive"
+		archiveCat.Locales[locale].Name = "Archive"
+		archiveCat.Locales[locale].Unlisted = true
+	}
+
+	var yearCat *Category
+	for i, ym := range months {
+		if i == 0 || ym.year != months[i-1].year {
+			yearCat = NewCategory(siteinfo)
+			yearCat.Parent = archiveCat
+			yearCat.Virtual = true
+			for locale := range siteinfo.Locales {
+				yearCat.Locales[locale].Basename = fmt.Sprint(ym.year)
+				yearCat.Locales[locale].Name = fmt.Sprint(ym.year)
+				yearCat.Locales[locale].Unlisted = true
+			}
+			archiveCat.SubCategories = append(archiveCat.SubCategories, yearCat)
+		}
+
+		monthCat := NewCategory(siteinfo)
+		monthCat.Parent = yearCat
+		monthCat.Virtual = true
+		for locale := range siteinfo.Locales {
+			monthCat.Locales[locale].Basename = fmt.Sprintf("%02d", ym.month)
+			monthCat.Locales[locale].Name = fmt.Sprintf("%v %v", monthName(locales, locale, ym.month), ym.year)
+			monthCat.Locales[locale].Unlisted = true
+			monthCat.Locales[locale].Pages = pages[ym][locale]
+			yearCat.Locales[locale].Pages = append(yearCat.Locales[locale].Pages, pages[ym][locale]...)
+		}
+		yearCat.SubCategories = append(yearCat.SubCategories, monthCat)
+	}
+	return archiveCat
+}
+
+// anyLocale returns one of the locales of a category.
+func (cat *Category) anyLocale() string {
+	for locale := range cat.Locales {
+		return locale
+	}
+	return ""
+}
+
+// ArchiveCategory returns the virtual category with basename "archive" at the root, or nil if there is none.
+func (cat *Category) ArchiveCategory() *Category {
+	for _, subCat := range cat.Tree().SubCategories {
+		if subCat.Virtual && subCat.Locales[subCat.anyLocale()].Basename == "archive" {
+			return subCat
+		}
+	}
+	return nil
+}
+
+// Archive returns the years and months in which pages were published in a locale, most recent first,
+// with the number of pages of each, for sidebars.
+func (cat *Category) Archive(locale string) []ArchiveYear {
+	archiveCat := cat.ArchiveCategory()
+	if archiveCat == nil {
+		return nil
+	}
+	var years []ArchiveYear
+	for _, yearCat := range archiveCat.SubCategories {
+		year := ArchiveYear{
+			Name:  yearCat.Locales[locale].Name,
+			Path:  yearCat.Path(locale),
+			Count: len(yearCat.RecentPages(-1, locale)),
+		}
+		if year.Count == 0 {
+			continue
+		}
+		year.Year, _ = strconv.Atoi(yearCat.Locales[locale].Basename)
+		for _, monthCat := range yearCat.SubCategories {
+			month := ArchiveMonth{
+				Name:  monthCat.Locales[locale].Name,
+				Path:  monthCat.Path(locale),
+				Count: len(monthCat.RecentPages(-1, locale)),
+			}
+			if month.Count == 0 {
+				continue
+			}
+			m, _ := strconv.Atoi(monthCat.Locales[locale].Basename)
+			month.Month = time.Month(m)
+			year.Months = append(year.Months, month)
+		}
+		years = append(years, year)
+	}
+	return years
+}
@@ -0,0 +1,69 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCategory_Archive(t *testing.T) {
+	input := fstest.MapFS{
+		"siteinfo.json":            {Data: []byte(`{"locales": {"en": {"path": "/"}, "fr": {"path": "/fr"}}}`)},
+		"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+		"pages/a.en.md":            {Data: []byte("---\ndate: 2017-12-31\n---\n# A")},
+		"pages/blog/catinfo.json":  {Data: []byte(`{"name": "Blog"}`)},
+		"pages/blog/b.en.md":       {Data: []byte("---\ndate: 2018-05-01\n---\n# B")},
+		"pages/blog/c.en.md":       {Data: []byte("---\ndate: 2018-05-20\n---\n# C")},
+		"pages/blog/d.en.md":       {Data: []byte("---\ndate: 2018-01-02\n---\n# D")},
+		"pages/blog/d.fr.md":       {Data: []byte("---\ndate: 2018-01-02\n---\n# D")},
+		"pages/blog/e.en.md":       {Data: []byte("# No date")},
+		"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ .Page.Title }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml": {Data: []byte("en:\n    archive:\n        page_list_name: \"Archive: {{$1}}\"\n")},
+		"templates/locales/fr.yml": {Data: []byte("fr:\n    archive:\n        page_list_name: \"Archives : {{$1}}\"\n    dates:\n        months:\n            january: janvier\n")},
+	}
+	out := NewMapOutput()
+	s, err := LoadSite(context.Background(), Options{FS: input, Output: out})
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+
+	want := []ArchiveYear{
+		{2018, "2018", "/archive/2018/", 3, []ArchiveMonth{
+			{time.May, "May 2018", "/archive/2018/05/", 2},
+			{time.January, "January 2018", "/archive/2018/01/", 1},
+		}},
+		{2017, "2017", "/archive/2017/", 1, []ArchiveMonth{
+			{time.December, "December 2017", "/archive/2017/12/", 1},
+		}},
+	}
+	if got := s.Tree.Archive("en"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	want = []ArchiveYear{
+		{2018, "2018", "/archive/2018/", 1, []ArchiveMonth{
+			{time.January, "janvier 2018", "/archive/2018/01/", 1},
+		}},
+	}
+	if got := s.Tree.Archive("fr"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if _, err := s.Generate(context.Background(), Options{FS: input, Output: out}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	for name, want := range map[string]string{
+		"archive/2018/05/index.html":    "Archive: May 2018",
+		"fr/archive/2018/01/index.html": "Archives : janvier 2018",
+	} {
+		if got := string(out.Files()[name]); !strings.HasPrefix(got, want) {
+			t.Errorf("%v: got %q; want prefix %q", name, got, want)
+		}
+	}
+}
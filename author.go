@@ -2,19 +2,63 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
 	"fmt"
+	"html"
+	"path"
+	"strings"
+	"unicode"
 )
 
 // Author is the type for an author of the website.
+// Slug is the bit that goes in the URL of the page of the author, `/author/<slug>/`, made from the name by default.
+// Bio holds a short markdown biography for each locale.
+// Avatar is the path to an image of the author from the root of the website, like `/media/img/me.jpg`.
 type Author struct {
-	Name  string `json: "name"`
-	Email string `json: "email"`
+	Name    string            `json:"name"`
+	Email   string            `json:"email"`
+	Slug    string            `json:"slug,omitempty"`
+	Bio     map[string]string `json:"bio,omitempty"`
+	Avatar  string            `json:"avatar,omitempty"`
+	Website string            `json:"website,omitempty"`
+	Links   []AuthorLink      `json:"links,omitempty"`
 }
 
-// Helper prints a html link to an author.
+// AuthorLink is a link to a profile of an author on another website.
+type AuthorLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// slugify makes a slug of a name: lower case letters and digits, with dashes in between words.
+func slugify(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// Helper prints a html link to an author: to their email address, or else to their website.
 func (author *Author) Helper() string {
+	if author.Email == "" && author.Website != "" {
+		return fmt.Sprintf("<address><a href=\"%s\">%s</a></address>", html.EscapeString(author.Website), author.Name)
+	}
 	return fmt.Sprintf("<address><a href=\"mailto:%s\">%s</a></address>", author.Email, author.Name)
 }
+
+// PageURL returns the relative URL from curPage to the page of the author.
+func (author *Author) PageURL(curPage *Page, localePath string) string {
+	return path.Join(curPage.PathToRoot(localePath), localePath, "author", author.Slug, "index.html")
+}
+
+// LinkHelper prints a html link to the page of the author.
+func (author *Author) LinkHelper(curPage *Page, localePath string) string {
+	return fmt.Sprintf("<address><a href=\"%s\" rel=\"author\">%s</a></address>", author.PageURL(curPage, localePath), author.Name)
+}
+
+// BioHelper prints the biography of the author in a locale in html.
+func (author *Author) BioHelper(page *Page, locale, localePath string) string {
+	return string(Html([]byte(author.Bio[locale]), page, localePath))
+}
@@ -2,7 +2,7 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
 	"fmt"
@@ -14,8 +14,9 @@ func TestAuthor_Helper(t *testing.T) {
 		author *Author
 		want   string
 	}{
-		{&Author{"Épiste Olaire", "episte.olaire@mail.ma"}, "<address><a href=\"mailto:episte.olaire@mail.ma\">Épiste Olaire</a></address>"},
-		{&Author{"", ""}, "<address><a href=\"mailto:\"></a></address>"},
+		{&Author{Name: "Épiste Olaire", Email: "episte.olaire@mail.ma"}, "<address><a href=\"mailto:episte.olaire@mail.ma\">Épiste Olaire</a></address>"},
+		{&Author{}, "<address><a href=\"mailto:\"></a></address>"},
+		{&Author{Name: "A", Website: "https://a.example.com/?a=b&c=d"}, "<address><a href=\"https://a.example.com/?a=b&amp;c=d\">A</a></address>"},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
@@ -25,3 +26,41 @@ func TestAuthor_Helper(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthor_LinkHelper(t *testing.T) {
+	testCases := []struct {
+		author     *Author
+		page       *Page
+		localePath string
+		want       string
+	}{
+		{&Author{Name: "A", Slug: "a"}, &Page{Basename: "index"}, "/", "<address><a href=\"author/a/index.html\" rel=\"author\">A</a></address>"},
+		{&Author{Name: "A", Slug: "a"}, testCategory(CategoryLocaleData{Pages: []*Page{{Basename: "post"}}}).Locales["en"].Pages[0], "/fr", "<address><a href=\"../fr/author/a/index.html\" rel=\"author\">A</a></address>"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := tc.author.LinkHelper(tc.page, tc.localePath); got != tc.want {
+				t.Errorf("got %s; want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"Quentin Ribac", "quentin-ribac"},
+		{"  Épiste  O'Laire ", "épiste-o-laire"},
+		{"R2-D2", "r2-d2"},
+		{"!!!", ""},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := slugify(tc.name); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+// CacheName is the name of the file holding the keys of the generated files, used by incremental builds.
+const CacheName = ".tomato-cache.json"
+
+// cacheVersion is part of every key. It changes whenever tomato generates different files from the same input.
+const cacheVersion = 4
+
+// IncrementalOutput is an output that can reuse the files of the previous build written to it.
+type IncrementalOutput interface {
+	Output
+	// ReadPrevious returns the content of the named file in the previous build.
+	ReadPrevious(name string) ([]byte, error)
+	// Reuse copies the named file from the previous build, unchanged.
+	Reuse(name string) error
+}
+
+// buildCache decides which files of an incremental build can be kept from the previous build.
+// Each generated file has a key, hashing everything it is generated from:
+// the key of a page covers, through global, the templates, locale files, siteinfo, categories
+// and the meta-data and excerpts of all pages, since any page can show up in the navigation or in recent pages,
+// along with its own source and, for an index page, the sources of the pages it lists.
+// Media and assets are keyed by a hash of their content.
+type buildCache struct {
+	out    IncrementalOutput
+	global string
+	mutex  sync.Mutex
+	prev   map[string]string
+	next   map[string]string
+	reused int
+}
+
+// cacheFile is the content of the cache file.
+type cacheFile struct {
+	Version int               `json:"version"`
+	Files   map[string]string `json:"files"`
+}
+
+// newBuildCache returns the cache for generating s to out.
+// If out is not incremental, the cache does nothing.
+// If clean is set, no file is reused, but keys are still recorded for the next build.
+func newBuildCache(s *Site, out Output, clean bool) (*buildCache, error) {
+	c := &buildCache{prev: make(map[string]string), next: make(map[string]string)}
+	var ok bool
+	if c.out, ok = out.(IncrementalOutput); !ok {
+		return c, nil
+	}
+
+	var err error
+	if c.global, err = globalKey(s); err != nil {
+		return nil, err
+	}
+
+	if !clean {
+		var prev cacheFile
+		if data, err := c.out.ReadPrevious(CacheName); err == nil && json.Unmarshal(data, &prev) == nil && prev.Version == cacheVersion {
+			c.prev = prev.Files
+		}
+	}
+	return c, nil
+}
+
+// globalKey hashes the inputs every page depends on.
+func globalKey(s *Site) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "tomato %v\n", cacheVersion)
+
+	// templates and locale files
+	err := WalkDir(s.FS, "templates", func(fname string) error {
+		data, err := fs.ReadFile(s.FS, fname)
+		if err != nil {
+			return err
+		}
+		hashWrite(h, []byte(fname))
+		hashWrite(h, data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// siteinfo
+	data, err := json.Marshal(s.Siteinfo)
+	if err != nil {
+		return "", err
+	}
+	hashWrite(h, data)
+
+	// categories and meta-data of the pages, with their excerpt but not their content,
+	// sorted since the order of tag categories and of their pages may change from a build to the next
+	var entries []string
+	for catQueue := []*Category{s.Tree}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
+		data, err := json.Marshal(catQueue[0])
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, catQueue[0].Realname+" "+string(data))
+		for locale := range catQueue[0].Locales {
+			for _, page := range catQueue[0].Locales[locale].Pages {
+				meta := *page
+				meta.Category, meta.Content = nil, nil
+				data, err := json.Marshal(meta)
+				if err != nil {
+					return "", err
+				}
+				entries = append(entries, catQueue[0].Realname+" "+locale+" "+page.Path()+" "+string(data)+" "+page.Excerpt())
+			}
+		}
+	}
+	sort.Strings(entries)
+	for _, entry := range entries {
+		hashWrite(h, []byte(entry))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashWrite writes data to h, prefixed with its length so that consecutive writes cannot be confused.
+func hashWrite(h hash.Hash, data []byte) {
+	fmt.Fprintf(h, "%d:", len(data))
+	h.Write(data)
+}
+
+// pageKey returns the key of a page, or "" for a nil cache.
+// It covers the source of the page and, for an index page, those of the pages of its category.
+func (c *buildCache) pageKey(page *Page, locale string) string {
+	if c == nil || c.out == nil {
+		return ""
+	}
+	h := sha256.New()
+	hashWrite(h, []byte(c.global))
+	hashWrite(h, []byte(locale))
+	hashWrite(h, []byte(page.Path()))
+	hashWrite(h, page.Content)
+	if page.IsIndex() {
+		hashCategory(h, page.Category, locale)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// categoryKey returns the key of a file listing the pages of a category, like a feed, or "" for a nil cache.
+func (c *buildCache) categoryKey(cat *Category, locale, name string) string {
+	if c == nil || c.out == nil {
+		return ""
+	}
+	h := sha256.New()
+	hashWrite(h, []byte(c.global))
+	hashWrite(h, []byte(locale))
+	hashWrite(h, []byte(name))
+	hashCategory(h, cat, locale)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// siteKey returns the key of a file depending only on the meta-data of the pages of some locales, like a sitemap,
+// or "" for a nil cache.
+func (c *buildCache) siteKey(name string, locales []string) string {
+	if c == nil || c.out == nil {
+		return ""
+	}
+	h := sha256.New()
+	hashWrite(h, []byte(c.global))
+	hashWrite(h, []byte(name))
+	for _, locale := range locales {
+		hashWrite(h, []byte(locale))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashCategory writes the sources of the pages of a category and its subcategories to h.
+func hashCategory(h hash.Hash, cat *Category, locale string) {
+	var listed []string
+	for catQueue := []*Category{cat}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
+		for _, p := range catQueue[0].Locales[locale].Pages {
+			listed = append(listed, p.Path()+" "+string(p.Content))
+		}
+	}
+	sort.Strings(listed)
+	for _, p := range listed {
+		hashWrite(h, []byte(p))
+	}
+}
+
+// fileKey returns the key of a file of fsys copied as is, a hash of its content, or "" for a nil cache.
+func (c *buildCache) fileKey(fsys fs.FS, fname string) (string, error) {
+	if c == nil || c.out == nil {
+		return "", nil
+	}
+	f, err := fsys.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	fmt.Fprintf(h, "file %v\n", cacheVersion)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// keep records key as the key of the named file, and tells whether the file was generated from the same key
+// by the previous build. In that case, the file is reused and must not be created.
+// A nil cache never keeps anything.
+func (c *buildCache) keep(name, key string) (bool, error) {
+	if c == nil || c.out == nil {
+		return false, nil
+	}
+	name, err := cleanName(name)
+	if err != nil {
+		return false, err
+	}
+
+	c.mutex.Lock()
+	c.next[name] = key
+	prev, ok := c.prev[name]
+	c.mutex.Unlock()
+	if !ok || prev != key {
+		return false, nil
+	}
+
+	if err := c.out.Reuse(name); err != nil {
+		// the previous file may have been deleted: generate it again
+		return false, nil
+	}
+	c.mutex.Lock()
+	c.reused++
+	c.mutex.Unlock()
+	return true, nil
+}
+
+// save writes the keys of the generated files to the output, for the next build.
+func (c *buildCache) save() error {
+	if c == nil || c.out == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data, err := json.MarshalIndent(cacheFile{Version: cacheVersion, Files: c.next}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFile(c.out, CacheName, data)
+}
+
+// reusedCount returns the number of files reused from the previous build.
+func (c *buildCache) reusedCount() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.reused
+}
@@ -2,34 +2,97 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
+	"encoding/json"
 	"fmt"
-	"os"
 	"path"
 	"sort"
 	"strings"
-	"time"
 )
 
 // Category represents a category, that is, a directory in the tree.
 // Name and Description are fetched from a `catinfo.json` file that should exist in of every directory.
 // Basename is the bit that goes in the URL.
+// Virtual categories are made by tomato to list pages that belong to other categories, like tags and authors.
+// Author is set on the category of an author.
 type Category struct {
-	Parent        *Category                      `json: "-"`
-	SubCategories []*Category                    `json: "-"`
-	Realname      string                         `json: "-"`
-	Locales       map[string]*CategoryLocaleData `json: "locales"`
+	Parent        *Category                      `json:"-"`
+	SubCategories []*Category                    `json:"-"`
+	Realname      string                         `json:"-"`
+	Locales       map[string]*CategoryLocaleData `json:"locales"`
+	Virtual       bool                           `json:"virtual,omitempty"`
+	Author        *Author                        `json:"-"`
 }
 
 // CategoryLocaleData holds data of a category that changes with the locale
+// PageSize is the number of pages listed by each index page of the category, see Pager.
+// Params holds the custom keys of `catinfo.json`, along with those of the parent categories it does not override.
+// Fallback, if set, overrides the one of the parent category or of siteinfo.json, see Category.fallback.
 type CategoryLocaleData struct {
-	Basename    string  `json: "basename"`
-	Name        string  `json: "name"`
-	Description string  `json: "description"`
-	Unlisted    bool    `json: "unlisted"`
-	Pages       []*Page `json: "-"`
+	Basename    string                 `json:"basename"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Unlisted    bool                   `json:"unlisted"`
+	PageSize    int                    `json:"pageSize,omitempty"`
+	Fallback    *bool                  `json:"fallback,omitempty"`
+	Pages       []*Page                `json:"-"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+}
+
+// UnmarshalJSON reads the known keys of a category and puts the other ones in Params.
+// Params can also be given in a `params` object, as they are encoded, with the other keys taking precedence.
+func (data *CategoryLocaleData) UnmarshalJSON(b []byte) error {
+	type plain CategoryLocaleData
+	data.Params = nil
+	if err := json.Unmarshal(b, (*plain)(data)); err != nil {
+		return err
+	}
+	var keys map[string]interface{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	for key, value := range keys {
+		switch key {
+		case "basename", "name", "description", "unlisted", "pageSize", "fallback", "params":
+		default:
+			if data.Params == nil {
+				data.Params = make(map[string]interface{})
+			}
+			data.Params[key] = value
+		}
+	}
+	return nil
+}
+
+// inheritParams adds the params of the parent categories to the categories and the pages of the tree,
+// unless they define the same keys.
+func (cat *Category) inheritParams() {
+	for catQueue := []*Category{cat}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
+		for locale, data := range catQueue[0].Locales {
+			if catQueue[0].Parent != nil {
+				data.Params = mergeParams(catQueue[0].Parent.Locales[locale].Params, data.Params)
+			}
+			for _, page := range data.Pages {
+				if page.Category == catQueue[0] {
+					page.Params = mergeParams(data.Params, page.Params)
+				}
+			}
+		}
+	}
+}
+
+// mergeParams returns a new map holding the params of child, and those of parent not in child.
+func mergeParams(parent, child map[string]interface{}) map[string]interface{} {
+	params := make(map[string]interface{}, len(parent)+len(child))
+	for key, value := range parent {
+		params[key] = value
+	}
+	for key, value := range child {
+		params[key] = value
+	}
+	return params
 }
 
 // NewCategory returns an empty category with Locales initialized
@@ -84,7 +147,7 @@ func (cat *Category) mdTree(prefix string, showPages bool, locale, localePath st
 	}
 	if showPages {
 		for _, page := range SortPagesByRecent(cat.Locales[locale].Pages) {
-			if page.Basename != "index" {
+			if !page.IsIndex() && !page.Unlisted {
 				str += fmt.Sprintf("%s\t* [%s](%s)\n", prefix, page.Title, path.Clean(path.Join(localePath, page.Path())))
 			}
 		}
@@ -133,23 +196,40 @@ func (tree *Category) FindParent(fpath string) (*Category, error) {
 // FilterByTags returns all pages, of a category and its subcategories recursively,
 // that match at least one of a given set of tags.
 func (cat *Category) FilterByTags(tags []string, locale string) (pages []*Page) {
-	for _, page := range cat.Locales[locale].Pages {
-		if page.Unlisted || page.Category != cat {
-			continue
-		}
-	tagFor:
+	return cat.filter(locale, func(page *Page) bool {
 		for _, pageTag := range page.Tags {
 			for _, testTag := range tags {
 				if pageTag == testTag {
-					pages = append(pages, page)
-					break tagFor
+					return true
 				}
 			}
 		}
+		return false
+	})
+}
+
+// FilterByAuthor returns all pages, of a category and its subcategories recursively, written by an author.
+func (cat *Category) FilterByAuthor(author *Author, locale string) []*Page {
+	return cat.filter(locale, func(page *Page) bool {
+		for _, pageAuthor := range page.Authors {
+			if pageAuthor.Name == author.Name {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// filter returns the listed pages of a category and its listed subcategories recursively that match.
+func (cat *Category) filter(locale string, match func(page *Page) bool) (pages []*Page) {
+	for _, page := range cat.Locales[locale].Pages {
+		if !page.Unlisted && page.Category == cat && match(page) {
+			pages = append(pages, page)
+		}
 	}
 	for _, subCat := range cat.SubCategories {
 		if !subCat.Locales[locale].Unlisted {
-			pages = append(pages, subCat.FilterByTags(tags, locale)...)
+			pages = append(pages, subCat.filter(locale, match)...)
 		}
 	}
 	return
@@ -198,10 +278,13 @@ func (cat *Category) Path(locale string) string {
 	return cat.Parent.Path(locale) + cat.Locales[locale].Basename + "/"
 }
 
-// Tags returns all the tags present in pages in the category and all subcategories.
+// Tags returns all the tags present in listed pages in the category and all subcategories.
 func (cat *Category) Tags(locale string) []string {
 	tagsMap := make(map[string]bool)
 	for _, page := range cat.Locales[locale].Pages {
+		if page.Unlisted {
+			continue
+		}
 		for _, tag := range page.Tags {
 			tagsMap[tag] = true
 		}
@@ -249,23 +332,17 @@ func (cat *Category) RecentPages(n int, locale string) (pages []*Page) {
 }
 
 // SortPagesByRecent returns a copy of the slice sorted by recent first.
+// Pages without a date come after dated ones, and index pages last; pages with the same date keep their order.
 func SortPagesByRecent(pages []*Page) (ret []*Page) {
 	ret = append(ret, pages...)
-	sort.Slice(ret, func(i, j int) bool {
-		if ret[i].Basename == "index" || ret[j].Basename == "index" {
-			return ret[i].Basename != "index"
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].IsIndex() || ret[j].IsIndex() {
+			return !ret[i].IsIndex() && ret[j].IsIndex()
 		}
-		ti, err := time.Parse("2006-01-02", ret[i].Date)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, ret[i].Path(), err)
-			return false
-		}
-		tj, err := time.Parse("2006-01-02", ret[j].Date)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, ret[i].Path(), err)
-			return true
+		if ret[i].Date.IsZero() || ret[j].Date.IsZero() {
+			return !ret[i].Date.IsZero() && ret[j].Date.IsZero()
 		}
-		return ti.After(tj)
+		return ret[i].Date.After(ret[j].Date)
 	})
 	return
 }
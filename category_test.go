@@ -2,29 +2,51 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
+// testCategory returns a category with data for the "en" locale only.
+// The given pages and subcategories are attached to it.
+func testCategory(data CategoryLocaleData, subCats ...*Category) *Category {
+	cat := &Category{Locales: map[string]*CategoryLocaleData{"en": &data}, SubCategories: subCats}
+	for _, subCat := range subCats {
+		subCat.Parent = cat
+	}
+	for _, page := range data.Pages {
+		page.Category = cat
+		page.Locale = "en"
+	}
+	return cat
+}
+
 func TestCategory_mdTree(t *testing.T) {
 	testCases := []struct {
-		category  *Category
+		category  func() *Category
 		prefix    string
 		showPages bool
 		want      string
 	}{
-		{&Category{Name: "Name"}, "p", false, "p* [Name >](/index.html)\n"},
-		{&Category{Name: "Name", SubCategories: []*Category{{Name: "SubCat", Basename: "subcat", Parent: &Category{}}}}, "", false, "* [Name >](/index.html)\n\t* [SubCat >](/subcat/index.html)\n"},
-		{&Category{Name: "Name", Pages: []*Page{{Basename: "index"}}}, "", true, "* [Name >](/index.html)\n"},
-		{&Category{Name: "Name", Pages: []*Page{{Basename: "page", Title: "Page"}}}, "", true, "* [Name >](/index.html)\n\t* [Page](/page.html)\n"},
+		{func() *Category { return testCategory(CategoryLocaleData{Name: "Name"}) }, "p", false, "p* [Name >](/index.html)\n"},
+		{func() *Category {
+			return testCategory(CategoryLocaleData{Name: "Name"}, testCategory(CategoryLocaleData{Name: "SubCat", Basename: "subcat", Pages: []*Page{{Basename: "page"}}}))
+		}, "", false, "* [Name >](/index.html)\n\t* [SubCat >](/subcat/index.html)\n"},
+		{func() *Category {
+			return testCategory(CategoryLocaleData{Name: "Name", Pages: []*Page{{Basename: "index"}}})
+		}, "", true, "* [Name >](/index.html)\n"},
+		{func() *Category {
+			return testCategory(CategoryLocaleData{Name: "Name", Pages: []*Page{{Basename: "page", Title: "Page"}}})
+		}, "", true, "* [Name >](/index.html)\n\t* [Page](/page.html)\n"},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := string(tc.category.mdTree(tc.prefix, tc.showPages)); got != tc.want {
+			if got := string(tc.category().mdTree(tc.prefix, tc.showPages, "en", "/")); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -33,15 +55,15 @@ func TestCategory_mdTree(t *testing.T) {
 
 func TestCategory_NavHelper(t *testing.T) {
 	testCases := []struct {
-		category  Category
+		category  *Category
 		showPages bool
 		want      string
 	}{
-		{Category{Name: "Name"}, false, "<ul>\n<li><a href=\"./index.html\">Name &gt;</a></li>\n</ul>\n"},
+		{testCategory(CategoryLocaleData{Name: "Name"}), false, "<ul>\n<li><a href=\"./index.html\">Name &gt;</a></li>\n</ul>\n"},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.category.NavHelper(&Page{}, tc.showPages); got != tc.want {
+			if got := tc.category.NavHelper(&Page{}, tc.showPages, "en", "/"); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -49,25 +71,57 @@ func TestCategory_NavHelper(t *testing.T) {
 }
 
 func TestCategory_FilterByTags(t *testing.T) {
-	p0 := Page{Tags: []string{}}
-	p1 := Page{Tags: []string{"a", "b"}}
-	p2 := Page{Tags: []string{"a", "c"}}
-	p3 := Page{Tags: []string{"d"}}
+	p0 := &Page{Tags: []string{}}
+	p1 := &Page{Tags: []string{"a", "b"}}
+	p2 := &Page{Tags: []string{"a", "c"}}
+	p3 := &Page{Tags: []string{"d"}}
+	p4 := &Page{Tags: []string{"a"}, Unlisted: true}
 
 	testCases := []struct {
-		category *Category
+		pages    []*Page
+		subPages []*Page
 		tags     []string
 		want     []*Page
 	}{
-		{&Category{}, nil, nil},
-		{&Category{Pages: []*Page{&p0}}, nil, nil},
-		{&Category{Pages: []*Page{&p0}}, []string{"a"}, nil},
-		{&Category{Pages: []*Page{&p1, &p2, &p3}}, []string{"a"}, []*Page{&p1, &p2}},
-		{&Category{Pages: []*Page{&p0, &p1}, SubCategories: []*Category{{Pages: []*Page{&p2, &p3}}}}, []string{"a"}, []*Page{&p1, &p2}},
+		{nil, nil, nil, nil},
+		{[]*Page{p0}, nil, nil, nil},
+		{[]*Page{p0}, nil, []string{"a"}, nil},
+		{[]*Page{p1, p2, p3}, nil, []string{"a"}, []*Page{p1, p2}},
+		{[]*Page{p0, p1}, []*Page{p2, p3}, []string{"a"}, []*Page{p1, p2}},
+		{[]*Page{p1, p4}, nil, []string{"a"}, []*Page{p1}},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.category.FilterByTags(tc.tags); reflect.DeepEqual(got, tc.want) == false {
+			cat := testCategory(CategoryLocaleData{Pages: tc.pages}, testCategory(CategoryLocaleData{Pages: tc.subPages}))
+			if got := cat.FilterByTags(tc.tags, "en"); reflect.DeepEqual(got, tc.want) == false {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCategory_FilterByAuthor(t *testing.T) {
+	a, b := &Author{Name: "A"}, &Author{Name: "B"}
+	p0 := &Page{}
+	p1 := &Page{Authors: []*Author{a}}
+	p2 := &Page{Authors: []*Author{b, a}}
+	p3 := &Page{Authors: []*Author{b}}
+	p4 := &Page{Authors: []*Author{a}, Unlisted: true}
+
+	testCases := []struct {
+		pages    []*Page
+		subPages []*Page
+		want     []*Page
+	}{
+		{nil, nil, nil},
+		{[]*Page{p0, p3}, nil, nil},
+		{[]*Page{p0, p1}, []*Page{p2, p3}, []*Page{p1, p2}},
+		{[]*Page{p1, p4}, nil, []*Page{p1}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			cat := testCategory(CategoryLocaleData{Pages: tc.pages}, testCategory(CategoryLocaleData{Pages: tc.subPages}))
+			if got := cat.FilterByAuthor(&Author{Name: "A"}, "en"); !reflect.DeepEqual(got, tc.want) {
 				t.Errorf("got %v; want %v", got, tc.want)
 			}
 		})
@@ -76,16 +130,19 @@ func TestCategory_FilterByTags(t *testing.T) {
 
 func TestCategory_PageCount(t *testing.T) {
 	testCases := []struct {
-		category *Category
+		pages    []*Page
+		subPages []*Page
 		want     int
 	}{
-		{&Category{}, 0},
-		{&Category{Pages: []*Page{{}, {}, {}, {}}}, 4},
-		{&Category{Pages: []*Page{{}}, SubCategories: []*Category{{Pages: []*Page{{}}}}}, 2},
+		{nil, nil, 0},
+		{[]*Page{{}, {}, {}, {}}, nil, 4},
+		{[]*Page{{}}, []*Page{{}}, 2},
+		{[]*Page{{}, {Unlisted: true}}, nil, 1},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.category.PageCount(); got != tc.want {
+			cat := testCategory(CategoryLocaleData{Pages: tc.pages}, testCategory(CategoryLocaleData{Pages: tc.subPages}))
+			if got := cat.PageCount("en"); got != tc.want {
 				t.Errorf("got %d; want %d", got, tc.want)
 			}
 		})
@@ -97,13 +154,14 @@ func TestCategory_CategoryCount(t *testing.T) {
 		category *Category
 		want     int
 	}{
-		{&Category{}, 0},
-		{&Category{SubCategories: []*Category{{}, {}, {}, {}}}, 4},
-		{&Category{SubCategories: []*Category{{SubCategories: []*Category{{}}}}}, 2},
+		{testCategory(CategoryLocaleData{}), 0},
+		{testCategory(CategoryLocaleData{}, testCategory(CategoryLocaleData{}), testCategory(CategoryLocaleData{}), testCategory(CategoryLocaleData{}), testCategory(CategoryLocaleData{})), 4},
+		{testCategory(CategoryLocaleData{}, testCategory(CategoryLocaleData{}, testCategory(CategoryLocaleData{}))), 2},
+		{testCategory(CategoryLocaleData{}, testCategory(CategoryLocaleData{Unlisted: true}, testCategory(CategoryLocaleData{}))), 0},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.category.CategoryCount(); got != tc.want {
+			if got := tc.category.CategoryCount("en"); got != tc.want {
 				t.Errorf("got %d; want %d", got, tc.want)
 			}
 		})
@@ -115,13 +173,13 @@ func TestCategory_Path(t *testing.T) {
 		category *Category
 		want     string
 	}{
-		{&Category{}, "/"},
+		{testCategory(CategoryLocaleData{}), "/"},
 		{nil, "/"},
-		{&Category{Parent: &Category{}, Basename: "test"}, "/test/"},
+		{testCategory(CategoryLocaleData{}, testCategory(CategoryLocaleData{Basename: "test"})).SubCategories[0], "/test/"},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.category.Path(); got != tc.want {
+			if got := tc.category.Path("en"); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -133,12 +191,12 @@ func TestCategory_Tags(t *testing.T) {
 		category *Category
 		want     []string
 	}{
-		{&Category{}, nil},
-		{&Category{Pages: []*Page{{Tags: []string{"a", "b"}}}, SubCategories: []*Category{{Pages: []*Page{{Tags: []string{"b", "c"}}}}}}, []string{"a", "b", "c"}},
+		{testCategory(CategoryLocaleData{}), nil},
+		{testCategory(CategoryLocaleData{Pages: []*Page{{Tags: []string{"a", "b"}}}}, testCategory(CategoryLocaleData{Pages: []*Page{{Tags: []string{"b", "c"}}}})), []string{"a", "b", "c"}},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.category.Tags(); reflect.DeepEqual(got, tc.want) == false {
+			if got := tc.category.Tags("en"); reflect.DeepEqual(got, tc.want) == false {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -146,26 +204,32 @@ func TestCategory_Tags(t *testing.T) {
 }
 
 func TestCategory_RecentPages(t *testing.T) {
-	p0 := Page{Date: "2042-04-02"}
-	p1 := Page{Date: "2018-04-02"}
-	p2 := Page{Date: "2017-04-02"}
-	p3 := Page{Date: "2016-04-02"}
-	p4 := Page{Date: "hello"}
+	p0 := &Page{Date: time.Date(2042, 4, 2, 0, 0, 0, 0, time.UTC)}
+	p1 := &Page{Date: time.Date(2018, 4, 2, 0, 0, 0, 0, time.UTC)}
+	p2 := &Page{Date: time.Date(2017, 4, 2, 0, 0, 0, 0, time.UTC)}
+	p3 := &Page{Date: time.Date(2016, 4, 2, 0, 0, 0, 0, time.UTC)}
+	p4 := &Page{}
+	p5 := &Page{Date: time.Date(2018, 4, 2, 0, 0, 0, 0, time.UTC)}
 
 	testCases := []struct {
-		category *Category
+		pages    []*Page
+		subPages []*Page
 		n        int
 		want     []*Page
 	}{
-		{&Category{}, 0, nil},
-		{&Category{}, 5, nil},
-		{&Category{Pages: []*Page{&p3, &p2}, SubCategories: []*Category{{Pages: []*Page{&p1, &p0}}}}, 2, []*Page{&p0, &p1}},
-		{&Category{Pages: []*Page{&p0, &p4}}, 2, []*Page{&p0, &p4}},
-		{&Category{Pages: []*Page{&p4, &p0}}, 2, []*Page{&p0, &p4}},
+		{nil, nil, 0, nil},
+		{nil, nil, 5, nil},
+		{[]*Page{p3, p2}, []*Page{p1, p0}, 2, []*Page{p0, p1}},
+		{[]*Page{p3, p2}, []*Page{p1, p0}, -1, []*Page{p0, p1, p2, p3}},
+		{[]*Page{p0, p4}, nil, 2, []*Page{p0, p4}},
+		{[]*Page{p4, p0}, nil, 2, []*Page{p0, p4}},
+		{[]*Page{p5, p4, p1}, nil, -1, []*Page{p5, p1, p4}},
+		{[]*Page{p1, p4, p5}, nil, -1, []*Page{p1, p5, p4}},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.category.RecentPages(tc.n); reflect.DeepEqual(got, tc.want) == false {
+			cat := testCategory(CategoryLocaleData{Pages: tc.pages}, testCategory(CategoryLocaleData{Pages: tc.subPages}))
+			if got := cat.RecentPages(tc.n, "en"); reflect.DeepEqual(got, tc.want) == false {
 				t.Errorf("got %v; want %v", got, tc.want)
 			}
 		})
@@ -173,10 +237,10 @@ func TestCategory_RecentPages(t *testing.T) {
 }
 
 func TestCategory_FindParent(t *testing.T) {
-	cat3 := Category{Basename: "cat3"}
-	cat2 := Category{Basename: "cat2"}
-	cat1 := Category{Basename: "cat1", SubCategories: []*Category{&cat2}}
-	cat0 := Category{Basename: "cat0", SubCategories: []*Category{&cat1, &cat3}}
+	cat3 := &Category{Realname: "cat3"}
+	cat2 := &Category{Realname: "cat2"}
+	cat1 := &Category{Realname: "cat1", SubCategories: []*Category{cat2}}
+	cat0 := &Category{Realname: "cat0", SubCategories: []*Category{cat1, cat3}}
 
 	testCases := []struct {
 		fpath string
@@ -184,9 +248,9 @@ func TestCategory_FindParent(t *testing.T) {
 		err   bool
 	}{
 		{":root:", nil, false},
-		{"/", &cat0, false},
-		{"/cat3/plop.html", &cat3, false},
-		{"/cat1/cat2/hello.html", &cat2, false},
+		{"/", cat0, false},
+		{"/cat3/plop.html", cat3, false},
+		{"/cat1/cat2/hello.html", cat2, false},
 		{"/cat8/gnu.html", nil, true},
 	}
 	for tci, tc := range testCases {
@@ -201,3 +265,54 @@ func TestCategory_FindParent(t *testing.T) {
 		})
 	}
 }
+
+func TestCategoryLocaleData_UnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		json string
+		want CategoryLocaleData
+		err  bool
+	}{
+		{`{"name": "Blog", "unlisted": true}`, CategoryLocaleData{Name: "Blog", Unlisted: true}, false},
+		{`{"name": "Blog", "hero": "cat.jpg", "sidebar": {"hide": true}}`, CategoryLocaleData{Name: "Blog", Params: map[string]interface{}{"hero": "cat.jpg", "sidebar": map[string]interface{}{"hide": true}}}, false},
+		{`{"name": "Blog", "params": {"hero": "cat.jpg", "a": 1}, "hero": "dog.jpg"}`, CategoryLocaleData{Name: "Blog", Params: map[string]interface{}{"hero": "dog.jpg", "a": 1.0}}, false},
+		{`{"name": 42}`, CategoryLocaleData{}, true},
+		{`{"name": "Blog", "params": "hero"}`, CategoryLocaleData{}, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			var got CategoryLocaleData
+			err := json.Unmarshal([]byte(tc.json), &got)
+			if (err != nil) != tc.err {
+				t.Fatalf("got err = %v; want error: %v", err, tc.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCategory_inheritParams(t *testing.T) {
+	page := &Page{Basename: "page", Params: map[string]interface{}{"b": "page"}}
+	other := &Page{Basename: "other"}
+	sub := testCategory(CategoryLocaleData{Params: map[string]interface{}{"b": "sub", "c": "sub"}, Pages: []*Page{page, other}})
+	root := testCategory(CategoryLocaleData{Params: map[string]interface{}{"a": "root", "b": "root"}}, sub)
+	root.inheritParams()
+
+	testCases := []struct {
+		got  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{root.Locales["en"].Params, map[string]interface{}{"a": "root", "b": "root"}},
+		{sub.Locales["en"].Params, map[string]interface{}{"a": "root", "b": "sub", "c": "sub"}},
+		{page.Params, map[string]interface{}{"a": "root", "b": "page", "c": "sub"}},
+		{other.Params, map[string]interface{}{"a": "root", "b": "sub", "c": "sub"}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if !reflect.DeepEqual(tc.got, tc.want) {
+				t.Errorf("got %v; want %v", tc.got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severities of diagnostics.
+// Errors stop the build, warnings point at something that is probably not wanted.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in the source files of a website.
+// File is the path of the file in the input, empty if the problem is not tied to a file,
+// and Line the line in this file, zero if the problem is about the whole file.
+type Diagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// String returns the diagnostic in the usual `file:line: severity: message` form.
+func (d Diagnostic) String() string {
+	prefix := ""
+	if d.File != "" {
+		prefix = d.File + ": "
+		if d.Line > 0 {
+			prefix = fmt.Sprintf("%v:%v: ", d.File, d.Line)
+		}
+	}
+	return prefix + d.Severity + ": " + d.Message
+}
+
+// Check looks for problems in the website of opts without writing anything, and without stopping at the first one:
+// unknown authors, invalid dates, pages without a title, pages of a category sharing an ID or a basename,
+// directories without `catinfo.json` and categories without an index page.
+// If it finds no error, it also loads the website, to report any other error that would stop the build.
+// The diagnostics are sorted by file and line.
+func Check(ctx context.Context, opts Options) ([]Diagnostic, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	c := &checker{opts: opts}
+	if err := c.run(ctx); err != nil {
+		return nil, err
+	}
+
+	if c.errors == 0 {
+		opts.Log = nil
+		if _, err := LoadSite(ctx, opts); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			d := Diagnostic{Severity: SeverityError, Message: err.Error()}
+			if m := loadErrorRE.FindStringSubmatch(d.Message); m != nil {
+				d.File, d.Message = m[1], m[2]
+			}
+			c.report(d)
+		}
+	}
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		di, dj := c.diagnostics[i], c.diagnostics[j]
+		if di.File != dj.File {
+			return di.File < dj.File
+		}
+		return di.Line < dj.Line
+	})
+	return c.diagnostics, nil
+}
+
+// loadErrorRE matches the errors of LoadSite starting with the path of a source file.
+var loadErrorRE = regexp.MustCompile(`(?s)^((?:pages|templates)/[^:\s]+): (.*)$`)
+
+// checker gathers the diagnostics of Check.
+type checker struct {
+	opts        Options
+	siteinfo    Siteinfo
+	diagnostics []Diagnostic
+	errors      int
+}
+
+// report adds a diagnostic.
+func (c *checker) report(d Diagnostic) {
+	if d.Severity == SeverityError {
+		c.errors++
+	}
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// errorf reports an error at a line of a file.
+func (c *checker) errorf(file string, line int, format string, args ...interface{}) {
+	c.report(Diagnostic{File: file, Line: line, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnf reports a warning at a line of a file.
+func (c *checker) warnf(file string, line int, format string, args ...interface{}) {
+	c.report(Diagnostic{File: file, Line: line, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// checkedPage is what the checker remembers of a page to compare it with the other ones.
+type checkedPage struct {
+	fpath, locale, id, basename string
+}
+
+// run checks siteinfo.json, then the categories and the pages.
+func (c *checker) run(ctx context.Context) error {
+	var err error
+	if c.siteinfo, err = c.opts.loadSiteinfo(); err != nil {
+		c.errorf(strings.TrimPrefix(c.opts.configName(), "/"), 0, "%v", err)
+		return nil
+	}
+	for _, locale := range unsupportedCLDRLocales(c.siteinfo) {
+		c.warnf(strings.TrimPrefix(c.opts.configName(), "/"), 0, "no CLDR data for locale %v: dates, numbers and plurals are formatted as in English", locale)
+	}
+	if !dirExistsFS(c.opts.FS, "pages") {
+		c.errorf("pages", 0, "no pages directory")
+		return nil
+	}
+
+	// directories with a catinfo.json, and source files
+	categories := make(map[string]bool)
+	var dirs, pages []string
+	err = fs.WalkDir(c.opts.FS, "pages", func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, fpath)
+		case d.Name() == "catinfo.json":
+			categories[path.Dir(fpath)] = true
+			c.checkCatinfo(fpath)
+		case strings.HasSuffix(d.Name(), ".md"):
+			pages = append(pages, fpath)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if categories[dir] {
+			if parent := missingCategory(path.Dir(dir), categories); parent != "" {
+				c.errorf(path.Join(dir, "catinfo.json"), 0, "no parent category found: %v has no catinfo.json", parent)
+			}
+		}
+	}
+
+	var checked []checkedPage
+	for _, fpath := range pages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if page, ok := c.checkPage(fpath, categories); ok {
+			checked = append(checked, page)
+		}
+	}
+	c.checkDuplicates(checked)
+	c.checkIndexPages(checked, dirs, categories)
+	return nil
+}
+
+// checkCatinfo reports a catinfo.json that is not valid JSON.
+func (c *checker) checkCatinfo(fpath string) {
+	content, err := fs.ReadFile(c.opts.FS, fpath)
+	if err != nil {
+		c.errorf(fpath, 0, "%v", err)
+		return
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		line := 0
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			line = lineAt(content, err.Offset)
+		case *json.UnmarshalTypeError:
+			line = lineAt(content, err.Offset)
+		}
+		c.errorf(fpath, line, "invalid JSON: %v", err)
+	}
+}
+
+// checkPage reports the problems of a page on its own.
+// It returns the page for the checks involving several pages, and false if it could not be read.
+func (c *checker) checkPage(fpath string, categories map[string]bool) (checkedPage, bool) {
+	page := checkedPage{fpath: fpath}
+	var err error
+	if page.locale, page.id, page.basename, err = splitPageName(c.siteinfo, fpath); err != nil {
+		c.errorf(fpath, 0, "no locale found: name the file like page.<locale>.md, or set a locale with path / in siteinfo.json")
+		return page, false
+	}
+	if dir := missingCategory(path.Dir(fpath), categories); dir != "" {
+		c.errorf(fpath, 0, "no category found: %v has no catinfo.json", dir)
+	}
+
+	src, err := fs.ReadFile(c.opts.FS, fpath)
+	if err != nil {
+		c.errorf(fpath, 0, "%v", err)
+		return page, false
+	}
+	fm, content, err := ParseFrontMatter(src)
+	if err != nil {
+		c.errorf(fpath, frontMatterErrorLine(src, err), "%v", err)
+		return page, true
+	}
+
+	if fm.Format == FrontMatterLegacy {
+		names := make([]string, 0, len(fm.Params))
+		for name := range fm.Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c.warnf(fpath, frontMatterLine(src, name), "unknown directive %q, kept in the page params", "#!"+name)
+		}
+	}
+	if fm.Title == "" && firstHeading(content) == "" {
+		c.errorf(fpath, 0, "no title: set title in the front matter, or start the content with a # heading")
+	}
+	for _, name := range fm.Authors {
+		if _, err := c.siteinfo.FindAuthor(name); err != nil {
+			c.errorf(fpath, frontMatterLine(src, "author", "authors"), "unknown author %q, authors are defined in siteinfo.json", name)
+		}
+	}
+	for _, date := range []struct{ key, value string }{{"date", fm.Date}, {"updated", fm.Updated}, {"expires", fm.Expires}} {
+		if _, err := parseDate(date.value, c.siteinfo.location()); err != nil {
+			c.errorf(fpath, frontMatterLine(src, date.key), "%v: %v", date.key, err)
+		}
+	}
+	return page, true
+}
+
+// pageKey identifies a page of a directory and a locale by its ID or basename, or with no name the directory itself.
+type pageKey struct {
+	dir, locale, name string
+}
+
+// checkDuplicates reports the pages of a category and a locale sharing an ID or a basename:
+// the former are mistaken for each other in translations, the latter are written to the same file.
+func (c *checker) checkDuplicates(pages []checkedPage) {
+	ids := make(map[pageKey]string)
+	basenames := make(map[pageKey]string)
+	for _, page := range pages {
+		dir := path.Dir(page.fpath)
+		if other, ok := ids[pageKey{dir, page.locale, page.id}]; ok {
+			c.errorf(page.fpath, 0, "duplicate ID %q in locale %v, also used by %v", page.id, page.locale, other)
+		} else {
+			ids[pageKey{dir, page.locale, page.id}] = page.fpath
+		}
+		if other, ok := basenames[pageKey{dir, page.locale, page.basename}]; ok {
+			c.errorf(page.fpath, 0, "duplicate basename %q in locale %v, also used by %v", page.basename, page.locale, other)
+		} else {
+			basenames[pageKey{dir, page.locale, page.basename}] = page.fpath
+		}
+	}
+}
+
+// checkIndexPages warns about the categories holding pages in a locale without an index page in that locale,
+// whose index is then a generated list of pages.
+func (c *checker) checkIndexPages(pages []checkedPage, dirs []string, categories map[string]bool) {
+	hasPages := make(map[pageKey]bool)
+	hasIndex := make(map[pageKey]bool)
+	for _, page := range pages {
+		if page.basename == "index" {
+			hasIndex[pageKey{path.Dir(page.fpath), page.locale, ""}] = true
+		}
+		for dir := path.Dir(page.fpath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			hasPages[pageKey{dir, page.locale, ""}] = true
+		}
+	}
+	var locales []string
+	for locale := range c.siteinfo.Locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, dir := range dirs {
+		if !categories[dir] {
+			continue
+		}
+		for _, locale := range locales {
+			if hasPages[pageKey{dir, locale, ""}] && !hasIndex[pageKey{dir, locale, ""}] {
+				c.warnf(path.Join(dir, "catinfo.json"), 0, "no index page in locale %v: a list of the pages of the category is generated instead", locale)
+			}
+		}
+	}
+}
+
+// missingCategory returns the deepest of dir and its parents without a catinfo.json, or "" if they all have one.
+func missingCategory(dir string, categories map[string]bool) string {
+	for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if !categories[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// frontMatterLine returns the line of the first of keys in the front matter at the beginning of src,
+// whether YAML, TOML or legacy `#!` directives, or 0 if none is found.
+func frontMatterLine(src []byte, keys ...string) int {
+	lines := strings.Split(string(src), "\n")
+	delim := strings.TrimSpace(lines[0])
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if i > 0 && (delim == "---" || delim == "+++") && line == delim {
+			break
+		}
+		if delim != "---" && delim != "+++" && line != "" && !strings.HasPrefix(line, "#!") {
+			break
+		}
+		line = strings.TrimPrefix(line, "#!")
+		for _, key := range keys {
+			if rest := strings.TrimPrefix(line, key); rest != line {
+				if rest = strings.TrimSpace(rest); rest == "" || rest[0] == ':' || rest[0] == '=' {
+					return i + 1
+				}
+			}
+		}
+	}
+	return 0
+}
+
+var (
+	frontMatterLineRE        = regexp.MustCompile(`line (\d+)`)
+	frontMatterErrorKeyRE    = regexp.MustCompile(`^([\w-]+): `)
+	frontMatterErrorFormatRE = regexp.MustCompile(`^invalid (yaml|toml) front matter`)
+)
+
+// frontMatterErrorLine returns the line of src an error of ParseFrontMatter is about, or 0 if it is unknown.
+func frontMatterErrorLine(src []byte, err error) int {
+	msg := err.Error()
+	if frontMatterErrorFormatRE.MatchString(msg) {
+		// the YAML and TOML parsers count lines from the one following the opening delimiter
+		if m := frontMatterLineRE.FindStringSubmatch(msg); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n + 1
+		}
+		return 0
+	}
+	if m := frontMatterErrorKeyRE.FindStringSubmatch(msg); m != nil {
+		return frontMatterLine(src, m[1])
+	}
+	return 0
+}
+
+// lineAt returns the line of the byte at offset in content, starting at 1.
+func lineAt(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	return 1 + bytes.Count(content[:offset], []byte("\n"))
+}
@@ -0,0 +1,128 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheck(t *testing.T) {
+	base := func() fstest.MapFS {
+		return fstest.MapFS{
+			"siteinfo.json":            {Data: []byte(`{"locales": {"en": {"path": "/"}}, "authors": [{"name": "A"}]}`)},
+			"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+			"pages/index.en.md":        {Data: []byte("---\nauthor: A\ndate: 2018-01-01\n---\n# Home")},
+			"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+			"templates/locales/en.yml": {Data: []byte("en:\n    locale_name: English\n")},
+		}
+	}
+	testCases := []struct {
+		files map[string]string
+		want  []Diagnostic
+	}{
+		{nil, nil},
+		{
+			map[string]string{"pages/post.en.md": "---\ntitle: Post\nauthor: [A, B]\ndate: 2018-02-30\nexpires: soon\n---\n"},
+			[]Diagnostic{
+				{"pages/post.en.md", 3, SeverityError, `unknown author "B", authors are defined in siteinfo.json`},
+				{"pages/post.en.md", 4, SeverityError, `date: invalid date "2018-02-30", want YYYY-MM-DD with an optional time like 15:04 and timezone like +02:00`},
+				{"pages/post.en.md", 5, SeverityError, `expires: invalid date "soon", want YYYY-MM-DD with an optional time like 15:04 and timezone like +02:00`},
+			},
+		},
+		{
+			map[string]string{"pages/post.en.md": "#!date: 2018-01-01\n#!author: C\n\nno heading"},
+			[]Diagnostic{
+				{"pages/post.en.md", 0, SeverityError, "no title: set title in the front matter, or start the content with a # heading"},
+				{"pages/post.en.md", 2, SeverityError, `unknown author "C", authors are defined in siteinfo.json`},
+			},
+		},
+		{
+			map[string]string{"pages/post.en.md": "#!date: 2018-01-01\n#!publish\n"},
+			[]Diagnostic{
+				{"pages/post.en.md", 0, SeverityError, "no title: set title in the front matter, or start the content with a # heading"},
+				{"pages/post.en.md", 2, SeverityWarning, `unknown directive "#!publish", kept in the page params`},
+			},
+		},
+		{
+			map[string]string{"pages/post.en.md": "---\ntitle: T\ndraft: maybe\n---\n"},
+			[]Diagnostic{{"pages/post.en.md", 3, SeverityError, "draft: got maybe, want true or false"}},
+		},
+		{
+			map[string]string{"pages/00.post.en.md": "# A", "pages/01.post.en.md": "# B", "pages/00.other.en.md": "# C"},
+			[]Diagnostic{
+				{"pages/00.post.en.md", 0, SeverityError, `duplicate ID "00" in locale en, also used by pages/00.other.en.md`},
+				{"pages/01.post.en.md", 0, SeverityError, `duplicate basename "post" in locale en, also used by pages/00.post.en.md`},
+			},
+		},
+		{
+			map[string]string{"pages/blog/post.en.md": "# Post", "pages/blog/old/catinfo.json": `{"name": "Old"}`},
+			[]Diagnostic{
+				{"pages/blog/old/catinfo.json", 0, SeverityError, "no parent category found: pages/blog has no catinfo.json"},
+				{"pages/blog/post.en.md", 0, SeverityError, "no category found: pages/blog has no catinfo.json"},
+			},
+		},
+		{
+			map[string]string{"pages/blog/catinfo.json": "{\n\t\"name\": \"Blog\",\n}", "pages/blog/post.en.md": "# Post"},
+			[]Diagnostic{
+				{"pages/blog/catinfo.json", 0, SeverityWarning, "no index page in locale en: a list of the pages of the category is generated instead"},
+				{"pages/blog/catinfo.json", 3, SeverityError, "invalid JSON: invalid character '}' looking for beginning of object key string"},
+			},
+		},
+		{
+			map[string]string{"templates/page.html": "{{ define \"Header\" }}{{ end"},
+			[]Diagnostic{{"", 0, SeverityError, `when parsing templates: template: page.html:1: unclosed action`}},
+		},
+		{
+			map[string]string{
+				"siteinfo.json":            `{"locales": {"en": {"path": "/"}, "it": {"path": "/it"}}, "authors": [{"name": "A"}]}`,
+				"pages/catinfo.json":       `{"en": {"name": "Home"}, "it": {"name": "Home"}}`,
+				"pages/index.it.md":        "# Home",
+				"templates/locales/it.yml": "it:\n    locale_name: Italiano\n",
+			},
+			[]Diagnostic{{"siteinfo.json", 0, SeverityWarning, "no CLDR data for locale it: dates, numbers and plurals are formatted as in English"}},
+		},
+		{
+			map[string]string{"siteinfo.json": `{"timezone": "Mars/Olympus"}`},
+			[]Diagnostic{{"siteinfo.json", 0, SeverityError, `incorrect siteinfo.json: unknown timezone "Mars/Olympus"`}},
+		},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			input := base()
+			for name, content := range tc.files {
+				input[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+			got, err := Check(context.Background(), Options{FS: input, Output: NewMapOutput()})
+			if err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiagnostic_String(t *testing.T) {
+	testCases := []struct {
+		d    Diagnostic
+		want string
+	}{
+		{Diagnostic{"pages/a.md", 3, SeverityError, "oops"}, "pages/a.md:3: error: oops"},
+		{Diagnostic{"pages/a.md", 0, SeverityWarning, "hmm"}, "pages/a.md: warning: hmm"},
+		{Diagnostic{"", 0, SeverityError, "oops"}, "error: oops"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := tc.d.String(); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
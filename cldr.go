@@ -0,0 +1,226 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qor/i18n"
+	"github.com/theplant/cldr"
+)
+
+// cldrLocales holds the CLDR data used to format dates, numbers and plurals, for the languages tomato knows.
+// Locales of siteinfo.json like `fr-CA` or `fr_CA` use the data of their language.
+// The data of English is used for other languages, with the names of months and days given by the locale files.
+var cldrLocales = map[string]*cldr.Locale{
+	"en": {
+		Locale:     "en",
+		PluralRule: "2A",
+		Number: cldr.Number{
+			Symbols: cldr.Symbols{Decimal: ".", Group: ",", Negative: "-", Percent: "%", PerMille: "‰"},
+			Formats: cldr.NumberFormats{Decimal: "#,##0.###", Currency: "¤#,##0.00", Percent: "#,##0%"},
+		},
+		Calendar: cldr.Calendar{
+			Formats: cldr.CalendarFormats{
+				Date:     cldr.CalendarDateFormat{Full: "EEEE, MMMM d, y", Long: "MMMM d, y", Medium: "MMM d, y", Short: "M/d/yy"},
+				Time:     cldr.CalendarDateFormat{Full: "h:mm:ss a zzzz", Long: "h:mm:ss a z", Medium: "h:mm:ss a", Short: "h:mm a"},
+				DateTime: cldr.CalendarDateFormat{Full: "{1} 'at' {0}", Long: "{1} 'at' {0}", Medium: "{1}, {0}", Short: "{1}, {0}"},
+			},
+			FormatNames: cldr.CalendarFormatNames{
+				Months: cldr.CalendarMonthFormatNames{
+					Abbreviated: cldr.CalendarMonthFormatNameValue{Jan: "Jan", Feb: "Feb", Mar: "Mar", Apr: "Apr", May: "May", Jun: "Jun", Jul: "Jul", Aug: "Aug", Sep: "Sep", Oct: "Oct", Nov: "Nov", Dec: "Dec"},
+					Wide:        cldr.CalendarMonthFormatNameValue{Jan: "January", Feb: "February", Mar: "March", Apr: "April", May: "May", Jun: "June", Jul: "July", Aug: "August", Sep: "September", Oct: "October", Nov: "November", Dec: "December"},
+				},
+				Days: cldr.CalendarDayFormatNames{
+					Abbreviated: cldr.CalendarDayFormatNameValue{Sun: "Sun", Mon: "Mon", Tue: "Tue", Wed: "Wed", Thu: "Thu", Fri: "Fri", Sat: "Sat"},
+					Wide:        cldr.CalendarDayFormatNameValue{Sun: "Sunday", Mon: "Monday", Tue: "Tuesday", Wed: "Wednesday", Thu: "Thursday", Fri: "Friday", Sat: "Saturday"},
+				},
+				Periods: cldr.CalendarPeriodFormatNames{
+					Abbreviated: cldr.CalendarPeriodFormatNameValue{AM: "AM", PM: "PM"},
+				},
+			},
+		},
+	},
+	"fr": {
+		Locale:     "fr",
+		PluralRule: "2C",
+		Number: cldr.Number{
+			Symbols: cldr.Symbols{Decimal: ",", Group: "\u202f", Negative: "-", Percent: "%", PerMille: "‰"},
+			Formats: cldr.NumberFormats{Decimal: "#,##0.###", Currency: "#,##0.00 ¤", Percent: "#,##0 %"},
+		},
+		Calendar: cldr.Calendar{
+			Formats: cldr.CalendarFormats{
+				Date:     cldr.CalendarDateFormat{Full: "EEEE d MMMM y", Long: "d MMMM y", Medium: "d MMM y", Short: "dd/MM/y"},
+				Time:     cldr.CalendarDateFormat{Full: "HH:mm:ss zzzz", Long: "HH:mm:ss z", Medium: "HH:mm:ss", Short: "HH:mm"},
+				DateTime: cldr.CalendarDateFormat{Full: "{1} 'à' {0}", Long: "{1} 'à' {0}", Medium: "{1}, {0}", Short: "{1} {0}"},
+			},
+			FormatNames: cldr.CalendarFormatNames{
+				Months: cldr.CalendarMonthFormatNames{
+					Abbreviated: cldr.CalendarMonthFormatNameValue{Jan: "janv.", Feb: "févr.", Mar: "mars", Apr: "avr.", May: "mai", Jun: "juin", Jul: "juil.", Aug: "août", Sep: "sept.", Oct: "oct.", Nov: "nov.", Dec: "déc."},
+					Wide:        cldr.CalendarMonthFormatNameValue{Jan: "janvier", Feb: "février", Mar: "mars", Apr: "avril", May: "mai", Jun: "juin", Jul: "juillet", Aug: "août", Sep: "septembre", Oct: "octobre", Nov: "novembre", Dec: "décembre"},
+				},
+				Days: cldr.CalendarDayFormatNames{
+					Abbreviated: cldr.CalendarDayFormatNameValue{Sun: "dim.", Mon: "lun.", Tue: "mar.", Wed: "mer.", Thu: "jeu.", Fri: "ven.", Sat: "sam."},
+					Wide:        cldr.CalendarDayFormatNameValue{Sun: "dimanche", Mon: "lundi", Tue: "mardi", Wed: "mercredi", Thu: "jeudi", Fri: "vendredi", Sat: "samedi"},
+				},
+				Periods: cldr.CalendarPeriodFormatNames{
+					Abbreviated: cldr.CalendarPeriodFormatNameValue{AM: "AM", PM: "PM"},
+				},
+			},
+		},
+	},
+	"de": {
+		Locale:     "de",
+		PluralRule: "2A",
+		Number: cldr.Number{
+			Symbols: cldr.Symbols{Decimal: ",", Group: ".", Negative: "-", Percent: "%", PerMille: "‰"},
+			Formats: cldr.NumberFormats{Decimal: "#,##0.###", Currency: "#,##0.00 ¤", Percent: "#,##0 %"},
+		},
+		Calendar: cldr.Calendar{
+			Formats: cldr.CalendarFormats{
+				Date:     cldr.CalendarDateFormat{Full: "EEEE, d. MMMM y", Long: "d. MMMM y", Medium: "dd.MM.y", Short: "dd.MM.yy"},
+				Time:     cldr.CalendarDateFormat{Full: "HH:mm:ss zzzz", Long: "HH:mm:ss z", Medium: "HH:mm:ss", Short: "HH:mm"},
+				DateTime: cldr.CalendarDateFormat{Full: "{1} 'um' {0}", Long: "{1} 'um' {0}", Medium: "{1}, {0}", Short: "{1}, {0}"},
+			},
+			FormatNames: cldr.CalendarFormatNames{
+				Months: cldr.CalendarMonthFormatNames{
+					Abbreviated: cldr.CalendarMonthFormatNameValue{Jan: "Jan.", Feb: "Feb.", Mar: "März", Apr: "Apr.", May: "Mai", Jun: "Juni", Jul: "Juli", Aug: "Aug.", Sep: "Sept.", Oct: "Okt.", Nov: "Nov.", Dec: "Dez."},
+					Wide:        cldr.CalendarMonthFormatNameValue{Jan: "Januar", Feb: "Februar", Mar: "März", Apr: "April", May: "Mai", Jun: "Juni", Jul: "Juli", Aug: "August", Sep: "September", Oct: "Oktober", Nov: "November", Dec: "Dezember"},
+				},
+				Days: cldr.CalendarDayFormatNames{
+					Abbreviated: cldr.CalendarDayFormatNameValue{Sun: "So.", Mon: "Mo.", Tue: "Di.", Wed: "Mi.", Thu: "Do.", Fri: "Fr.", Sat: "Sa."},
+					Wide:        cldr.CalendarDayFormatNameValue{Sun: "Sonntag", Mon: "Montag", Tue: "Dienstag", Wed: "Mittwoch", Thu: "Donnerstag", Fri: "Freitag", Sat: "Samstag"},
+				},
+				Periods: cldr.CalendarPeriodFormatNames{
+					Abbreviated: cldr.CalendarPeriodFormatNameValue{AM: "AM", PM: "PM"},
+				},
+			},
+		},
+	},
+	"es": {
+		Locale:     "es",
+		PluralRule: "2A",
+		Number: cldr.Number{
+			Symbols: cldr.Symbols{Decimal: ",", Group: ".", Negative: "-", Percent: "%", PerMille: "‰"},
+			Formats: cldr.NumberFormats{Decimal: "#,##0.###", Currency: "#,##0.00 ¤", Percent: "#,##0 %"},
+		},
+		Calendar: cldr.Calendar{
+			Formats: cldr.CalendarFormats{
+				Date:     cldr.CalendarDateFormat{Full: "EEEE, d 'de' MMMM 'de' y", Long: "d 'de' MMMM 'de' y", Medium: "d MMM y", Short: "d/M/yy"},
+				Time:     cldr.CalendarDateFormat{Full: "H:mm:ss zzzz", Long: "H:mm:ss z", Medium: "H:mm:ss", Short: "H:mm"},
+				DateTime: cldr.CalendarDateFormat{Full: "{1}, {0}", Long: "{1}, {0}", Medium: "{1}, {0}", Short: "{1}, {0}"},
+			},
+			FormatNames: cldr.CalendarFormatNames{
+				Months: cldr.CalendarMonthFormatNames{
+					Abbreviated: cldr.CalendarMonthFormatNameValue{Jan: "ene", Feb: "feb", Mar: "mar", Apr: "abr", May: "may", Jun: "jun", Jul: "jul", Aug: "ago", Sep: "sept", Oct: "oct", Nov: "nov", Dec: "dic"},
+					Wide:        cldr.CalendarMonthFormatNameValue{Jan: "enero", Feb: "febrero", Mar: "marzo", Apr: "abril", May: "mayo", Jun: "junio", Jul: "julio", Aug: "agosto", Sep: "septiembre", Oct: "octubre", Nov: "noviembre", Dec: "diciembre"},
+				},
+				Days: cldr.CalendarDayFormatNames{
+					Abbreviated: cldr.CalendarDayFormatNameValue{Sun: "dom", Mon: "lun", Tue: "mar", Wed: "mié", Thu: "jue", Fri: "vie", Sat: "sáb"},
+					Wide:        cldr.CalendarDayFormatNameValue{Sun: "domingo", Mon: "lunes", Tue: "martes", Wed: "miércoles", Thu: "jueves", Fri: "viernes", Sat: "sábado"},
+				},
+				Periods: cldr.CalendarPeriodFormatNames{
+					Abbreviated: cldr.CalendarPeriodFormatNameValue{AM: "a. m.", PM: "p. m."},
+				},
+			},
+		},
+	},
+}
+
+func init() {
+	for _, loc := range cldrLocales {
+		cldr.RegisterLocale(loc)
+	}
+}
+
+// cldrLocale returns the CLDR data of a locale, that of its language, or else that of English.
+// ok is false when English is used for another language.
+func cldrLocale(locale string) (loc *cldr.Locale, ok bool) {
+	if loc, ok := cldrLocales[locale]; ok {
+		return loc, true
+	}
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		if loc, ok := cldrLocales[strings.ToLower(locale[:i])]; ok {
+			return loc, true
+		}
+	}
+	return cldrLocales["en"], false
+}
+
+// unsupportedCLDRLocales returns the sorted locales of a website for which cldrLocale falls back to English.
+func unsupportedCLDRLocales(siteinfo Siteinfo) []string {
+	var locales []string
+	for locale := range siteinfo.Locales {
+		if _, ok := cldrLocale(locale); !ok {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// cldrMutex serializes the registrations of registerCLDRLocales.
+var cldrMutex sync.Mutex
+
+// registerCLDRLocales registers the CLDR data of the locales of a website to the cldr package,
+// which qor i18n uses to choose the plural forms of `{{p "Count" (one "...") (other "...")}}` in translations.
+func registerCLDRLocales(siteinfo Siteinfo) {
+	cldrMutex.Lock()
+	defer cldrMutex.Unlock()
+	for locale := range siteinfo.Locales {
+		if _, ok := cldr.GetLocale(locale); ok {
+			continue
+		}
+		loc, _ := cldrLocale(locale)
+		data := *loc
+		data.Locale = locale
+		cldr.RegisterLocale(&data)
+	}
+}
+
+// dateStyles are the named CLDR formats of dates accepted by formatDate.
+var dateStyles = map[string]func(cldr.Calendar, time.Time) (string, error){
+	"full":   cldr.Calendar.FmtDateFull,
+	"long":   cldr.Calendar.FmtDateLong,
+	"medium": cldr.Calendar.FmtDateMedium,
+	"short":  cldr.Calendar.FmtDateShort,
+
+	"datetime-full":   cldr.Calendar.FmtDateTimeFull,
+	"datetime-long":   cldr.Calendar.FmtDateTimeLong,
+	"datetime-medium": cldr.Calendar.FmtDateTimeMedium,
+	"datetime-short":  cldr.Calendar.FmtDateTimeShort,
+}
+
+// formatNumber formats a number in a locale, like `1,234.5` in English and `1 234,5` in French.
+func formatNumber(locale string, n interface{}) string {
+	loc, _ := cldrLocale(locale)
+	switch n.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return loc.FmtNumber(n)
+	}
+	return fmt.Sprint(n)
+}
+
+// pluralForm returns the CLDR plural form of a number in a locale: "zero", "one", "two", "few", "many" or "other".
+func pluralForm(locale string, n interface{}) string {
+	loc, _ := cldrLocale(locale)
+	return string(cldr.FindRule(loc.Locale, n))
+}
+
+// plural returns the translation of key in the plural form of n, given by the `<key>.<form>` keys of the locale files,
+// like `pages.count.one` and `pages.count.other`, `{{$1}}` being n formatted by formatNumber.
+// The `<key>.other` key is used when the form of n has no key.
+func plural(locales *i18n.I18n, locale, key string, n interface{}) string {
+	for _, form := range []string{pluralForm(locale, n), cldr.PluralRuleOther} {
+		if translation := string(locales.T(locale, key+"."+form, formatNumber(locale, n))); translation != "" {
+			return translation
+		}
+	}
+	return formatNumber(locale, n)
+}
@@ -0,0 +1,96 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCLDRLocale(t *testing.T) {
+	testCases := []struct {
+		locale string
+		want   string
+		ok     bool
+	}{
+		{"fr", "fr", true},
+		{"fr-CA", "fr", true},
+		{"de_AT", "de", true},
+		{"ES-es", "es", true},
+		{"it", "en", false},
+		{"", "en", false},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			loc, ok := cldrLocale(tc.locale)
+			if loc.Locale != tc.want || ok != tc.ok {
+				t.Errorf("got %v, %v; want %v, %v", loc.Locale, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestUnsupportedCLDRLocales(t *testing.T) {
+	siteinfo := Siteinfo{Locales: map[string]SiteinfoLocaleData{"en": {}, "fr-CA": {}, "it": {}, "ja": {}}}
+	if got := unsupportedCLDRLocales(siteinfo); !reflect.DeepEqual(got, []string{"it", "ja"}) {
+		t.Errorf("got %q; want %q", got, []string{"it", "ja"})
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	testCases := []struct {
+		locale string
+		n      interface{}
+		want   string
+	}{
+		{"en", 3, "3"},
+		{"en", 1234567, "1,234,567"},
+		{"en", 1234.5, "1,234.5"},
+		{"fr", 1234.5, "1\u202f234,5"},
+		{"de", -1234, "-1.234"},
+		{"fr", "many", "many"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := formatNumber(tc.locale, tc.n); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPlural(t *testing.T) {
+	locales, err := LoadLocales(fstest.MapFS{
+		"en.yml": {Data: []byte("en:\n    pages:\n        one: \"{{$1}} page\"\n        other: \"{{$1}} pages\"\n")},
+		"fr.yml": {Data: []byte("fr:\n    pages:\n        one: \"{{$1}} page\"\n        other: \"{{$1}} pages\"\n    tags:\n        other: \"{{$1}} tags\"\n")},
+	}, ".")
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	testCases := []struct {
+		locale, key string
+		n           interface{}
+		want        string
+	}{
+		{"en", "pages", 0, "0 pages"},
+		{"en", "pages", 1, "1 page"},
+		{"en", "pages", 2, "2 pages"},
+		{"en", "pages", 1500, "1,500 pages"},
+		{"fr", "pages", 0, "0 page"},
+		{"fr", "pages", 1, "1 page"},
+		{"fr", "pages", 2, "2 pages"},
+		{"fr", "tags", 1, "1 tags"},
+		{"fr", "unknown", 1, "1"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := plural(locales, tc.locale, tc.key, tc.n); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,671 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+/*
+Tomato is a static website generator.
+
+Usage:
+
+	tomato <command> [flags] <input>
+
+The commands are:
+
+	build   generate the website found in the input directory
+	serve   generate the website, serve it on localhost and rebuild it on every change
+	new     create a new page in the input directory
+	check   report every problem of the website with its file and line, without writing anything
+	convert rewrite the legacy #! directives of pages as YAML front matter
+	i18n    report what is not translated to each locale, with `tomato i18n status`
+
+`tomato <input> [output]` is a shortcut for `tomato build --output <output> <input>`.
+Run `tomato <command> --help` for the flags of each command.
+*/
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezones of siteinfo.json, even without a timezone database on the system
+
+	"github.com/ribacq/tomato"
+)
+
+const usage = `Tomato is a static website generator.
+
+Usage:
+	tomato <command> [flags] <input>
+
+The commands are:
+	build   generate the website found in the input directory
+	serve   generate the website, serve it on localhost and rebuild it on every change
+	new     create a new page in the input directory
+	check   report every problem of the website with its file and line, without writing anything
+	convert rewrite the legacy #! directives of pages as YAML front matter
+	i18n    report what is not translated to each locale, with tomato i18n status
+
+tomato <input> [output] is a shortcut for tomato build --output <output> <input>.
+Run tomato <command> --help for the flags of each command.
+`
+
+// commands maps command names to their implementation.
+// A command receives the arguments following its name and returns the exit status of the program.
+var commands = map[string]func(args []string) int{
+	"build":   buildCommand,
+	"serve":   serveCommand,
+	"new":     newCommand,
+	"check":   checkCommand,
+	"convert": convertCommand,
+	"i18n":    i18nCommand,
+}
+
+// main is the entry point for the program.
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run dispatches the command-line arguments, without the program name, to the right command,
+// and returns the exit status of the program.
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return 0
+	}
+	if command, ok := commands[name]; ok {
+		return command(args[1:])
+	}
+	if strings.HasPrefix(name, "-") {
+		fmt.Fprintf(os.Stderr, "Error: unknown flag %v\n\n%v", name, usage)
+		return 2
+	}
+	if !tomato.DirectoryExists(name) {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %v\n\n%v", name, usage)
+		return 2
+	}
+
+	// legacy form: tomato <input> [output]
+	legacy := []string{name}
+	if len(args) > 1 {
+		legacy = append([]string{"--output", args[1]}, legacy...)
+	}
+	return buildCommand(legacy)
+}
+
+// commandFlags are the flags shared by all commands.
+type commandFlags struct {
+	output      string
+	config      string
+	locale      string
+	drafts      bool
+	draftSecret string
+	future      bool
+	jobs        int
+	clean       bool
+	quiet       bool
+	verbose     bool
+}
+
+// newFlagSet returns a flag set for the named command with the shared flags registered in cf.
+func newFlagSet(name, synopsis string, cf *commandFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tomato %v\n\nFlags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cf.output, "output", "", "output `directory`, or archive ending in .zip, .tar, .tar.gz or .tgz (default <input>_html)")
+	fs.StringVar(&cf.config, "config", "", "siteinfo.json `file` to use (default <input>/siteinfo.json)")
+	fs.StringVar(&cf.locale, "locale", "", "comma-separated `locales` to generate (default all)")
+	fs.BoolVar(&cf.drafts, "drafts", false, "include draft pages")
+	fs.StringVar(&cf.draftSecret, "draft-secret", "", "include draft pages, unlisted, at unguessable URLs made from this `secret`")
+	fs.BoolVar(&cf.future, "future", false, "include pages dated in the future")
+	fs.BoolVar(&cf.clean, "clean", false, "regenerate every file, even those that did not change since the previous build")
+	fs.IntVar(&cf.jobs, "jobs", 0, "number of pages rendered at once (default the number of CPUs)")
+	fs.BoolVar(&cf.quiet, "quiet", false, "only print errors")
+	fs.BoolVar(&cf.verbose, "verbose", false, "print detailed progress")
+	return fs
+}
+
+// parseFlags parses args with fs, allowing flags to come after positional arguments.
+// It returns the positional arguments, or a nil slice and the exit status if the program should stop.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, int) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, 0
+			}
+			return nil, 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if quiet, verbose := fs.Lookup("quiet"), fs.Lookup("verbose"); quiet != nil && verbose != nil && quiet.Value.String() == "true" && verbose.Value.String() == "true" {
+		fmt.Fprintln(fs.Output(), "--quiet and --verbose cannot be used together")
+		fs.Usage()
+		return nil, 2
+	}
+	return positional, -1
+}
+
+// options turns the shared flags into build options, with default values set.
+func (cf *commandFlags) options(inputDir string) (tomato.Options, error) {
+	opts := tomato.Options{
+		InputDir:    inputDir,
+		ConfigPath:  cf.config,
+		Drafts:      cf.drafts,
+		DraftSecret: cf.draftSecret,
+		Future:      cf.future,
+		Jobs:        cf.jobs,
+		Clean:       cf.clean,
+		Verbose:     cf.verbose,
+	}
+	if archiveFormat(cf.output) == "" {
+		opts.OutputDir = cf.output
+	}
+	if !cf.quiet {
+		opts.Log = os.Stdout
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == "" {
+			opts.Color = true
+		}
+	}
+	for _, locale := range strings.Split(cf.locale, ",") {
+		if locale = strings.TrimSpace(locale); locale != "" {
+			opts.Locales = append(opts.Locales, locale)
+		}
+	}
+	return opts.Normalize()
+}
+
+// printf prints a progress message, unless in quiet mode.
+func printf(opts tomato.Options, format string, args ...interface{}) {
+	if opts.Log != nil {
+		fmt.Fprintf(opts.Log, format+"\n", args...)
+	}
+}
+
+// section prints the title of a new step, unless in quiet mode.
+func section(opts tomato.Options, format string, args ...interface{}) {
+	if opts.Color {
+		format = "\x1b[1m" + format + "\x1b[0m"
+	}
+	printf(opts, "\n"+format, args...)
+}
+
+// fail prints an error and returns the exit status for failures.
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	return 1
+}
+
+// buildCommand generates the website once.
+func buildCommand(args []string) int {
+	var cf commandFlags
+	fs := newFlagSet("build", "build [flags] <input>", &cf)
+	checkLinks := fs.Bool("check-links", false, "check the links of the generated pages and list the unused media files")
+	positional, status := parseFlags(fs, args)
+	if positional == nil {
+		return status
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := cf.options(positional[0])
+	if err != nil {
+		return fail(err)
+	}
+	output := cf.output
+	var closeArchive func() error
+	if format := archiveFormat(cf.output); format != "" {
+		if *checkLinks {
+			return fail(fmt.Errorf("--check-links needs an output directory, not an archive"))
+		}
+		opts.Output, closeArchive, err = createArchive(cf.output, format)
+	} else {
+		opts, err = opts.NormalizeOutput()
+		output = opts.OutputDir
+	}
+	if err != nil {
+		return fail(err)
+	}
+	printf(opts, "Input: %v", opts.InputDir)
+	printf(opts, "Output: %v", output)
+
+	site, err := tomato.LoadSite(context.Background(), opts)
+	if err == nil {
+		_, err = site.Generate(context.Background(), opts)
+	}
+	if closeArchive != nil {
+		if closeErr := closeArchive(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(cf.output)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if *checkLinks {
+		return printLinkReport(site, opts)
+	}
+	return 0
+}
+
+// printLinkReport checks the links of a generated website and prints the problems found.
+// It returns the exit status of the program, a failure if there are broken links.
+func printLinkReport(site *tomato.Site, opts tomato.Options) int {
+	section(opts, "Checking links...")
+	report, err := site.CheckLinks(context.Background(), os.DirFS(opts.OutputDir))
+	if err != nil {
+		return fail(err)
+	}
+	for _, link := range report.Broken {
+		page := link.File
+		if link.Source != "" {
+			page = fmt.Sprintf("%v (%v)", link.Source, link.File)
+		}
+		fmt.Printf("%v: %v: %v\n", page, link.Link, link.Reason)
+	}
+	if len(report.UnusedMedia) > 0 {
+		fmt.Printf("%v media files are not linked to by any page:\n", len(report.UnusedMedia))
+		for _, name := range report.UnusedMedia {
+			fmt.Printf("  %v\n", name)
+		}
+	}
+	if len(report.Broken) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %v broken links\n", len(report.Broken))
+		return 1
+	}
+	printf(opts, "No broken link found.")
+	return 0
+}
+
+// archiveFormat returns the archive format matching the extension of name, or "" if name is not an archive.
+func archiveFormat(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	}
+	return ""
+}
+
+// createArchive creates the named archive file and returns an output writing to it.
+// The returned function closes the file, and must be called once the output is closed.
+func createArchive(name, format string) (tomato.Output, func() error, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch format {
+	case "zip":
+		return tomato.NewZipOutput(f), f.Close, nil
+	case "tar.gz":
+		gz := gzip.NewWriter(f)
+		return tomato.NewTarOutput(gz), func() error {
+			if err := gz.Close(); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}, nil
+	default:
+		return tomato.NewTarOutput(f), f.Close, nil
+	}
+}
+
+// serveCommand generates the website, serves it and rebuilds it on every change.
+func serveCommand(args []string) int {
+	var cf commandFlags
+	fs := newFlagSet("serve", "serve [flags] <input>", &cf)
+	addr := fs.String("addr", defaultServeAddress, "`address` to listen on")
+	positional, status := parseFlags(fs, args)
+	if positional == nil {
+		return status
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if archiveFormat(cf.output) != "" {
+		return fail(fmt.Errorf("serve needs an output directory, not an archive"))
+	}
+
+	opts, err := cf.options(positional[0])
+	if err == nil {
+		opts, err = opts.NormalizeOutput()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	printf(opts, "Input: %v", opts.InputDir)
+	printf(opts, "Output: %v", opts.OutputDir)
+
+	if err := serve(opts, *addr); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// checkCommand reports the problems of the website, in the human or JSON format.
+// It fails if there is any error, warnings alone do not make it fail.
+func checkCommand(args []string) int {
+	var cf commandFlags
+	fs := newFlagSet("check", "check [flags] <input>", &cf)
+	jsonOutput := fs.Bool("json", false, "print the problems as a JSON array")
+	positional, status := parseFlags(fs, args)
+	if positional == nil {
+		return status
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := cf.options(positional[0])
+	if err != nil {
+		return fail(err)
+	}
+
+	diagnostics, err := tomato.Check(context.Background(), opts)
+	if err != nil {
+		return fail(err)
+	}
+	errors, warnings := 0, 0
+	for _, d := range diagnostics {
+		if d.Severity == tomato.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	if *jsonOutput {
+		if diagnostics == nil {
+			diagnostics = []tomato.Diagnostic{}
+		}
+		data, err := json.MarshalIndent(diagnostics, "", "\t")
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+		switch {
+		case len(diagnostics) == 0:
+			section(opts, "No problem found.")
+		case !cf.quiet:
+			fmt.Printf("\n%v errors, %v warnings\n", errors, warnings)
+		}
+	}
+	if errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// newCommand creates a new page, with its meta-data filled in, as a draft.
+// The page path is relative to the pages directory, like `blog/my-post.en.md`.
+// If it has no locale suffix, the one given by --locale or the root locale is added.
+func newCommand(args []string) int {
+	var cf commandFlags
+	fs := newFlagSet("new", "new [flags] <input> <page>", &cf)
+	positional, status := parseFlags(fs, args)
+	if positional == nil {
+		return status
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := cf.options(positional[0])
+	if err != nil {
+		return fail(err)
+	}
+	configPath := opts.ConfigPath
+	if configPath == "" {
+		configPath = filepath.Join(opts.InputDir, "siteinfo.json")
+	}
+	siteinfo, err := tomato.LoadSiteinfo(os.DirFS(filepath.Dir(configPath)), filepath.Base(configPath))
+	if err != nil {
+		return fail(err)
+	}
+
+	// find locale
+	fpath := path.Clean("/" + strings.TrimSuffix(filepath.ToSlash(positional[1]), ".md"))
+	locale := ""
+	for l := range siteinfo.Locales {
+		if strings.HasSuffix(fpath, "."+l) {
+			locale = l
+		}
+	}
+	if locale == "" {
+		if len(opts.Locales) > 0 {
+			locale = opts.Locales[0]
+		} else {
+			for l := range siteinfo.Locales {
+				if siteinfo.Locales[l].Path == "/" {
+					locale = l
+				}
+			}
+		}
+		if _, ok := siteinfo.Locales[locale]; !ok {
+			return fail(fmt.Errorf("unable to detect locale for %v", positional[1]))
+		}
+		fpath += "." + locale
+	}
+	fpath = filepath.Join(opts.InputDir, "pages", filepath.FromSlash(fpath+".md"))
+
+	// check that the category exists and the page doesn’t
+	if !tomato.FileExists(filepath.Join(filepath.Dir(fpath), "catinfo.json")) {
+		return fail(fmt.Errorf("%v is not a category directory", filepath.Dir(fpath)))
+	}
+	if tomato.FileExists(fpath) || tomato.DirectoryExists(fpath) {
+		return fail(fmt.Errorf("%v already exists", fpath))
+	}
+
+	// title from the basename
+	basename := strings.Split(strings.TrimSuffix(filepath.Base(fpath), "."+locale+".md"), ".")
+	title := strings.Replace(basename[len(basename)-1], "-", " ", -1)
+	if len(title) > 0 {
+		title = strings.ToUpper(title[:1]) + title[1:]
+	}
+
+	fm := tomato.FrontMatter{Date: time.Now().Format("2006-01-02"), Draft: true}
+	if len(siteinfo.Authors) > 0 {
+		fm.Authors = []string{siteinfo.Authors[0].Name}
+	}
+	header, err := fm.YAML()
+	if err != nil {
+		return fail(err)
+	}
+	content := string(header) + "\n# " + title + "\n"
+
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	if err != nil {
+		return fail(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return fail(err)
+	}
+	printf(opts, "Created %v", fpath)
+	return 0
+}
+
+// convertCommand rewrites the legacy `#!` directives at the beginning of every page as YAML front matter.
+func convertCommand(args []string) int {
+	var cf commandFlags
+	fs := newFlagSet("convert", "convert [flags] <input>", &cf)
+	dryRun := fs.Bool("dry-run", false, "only print the pages that would be converted")
+	positional, status := parseFlags(fs, args)
+	if positional == nil {
+		return status
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := cf.options(positional[0])
+	if err != nil {
+		return fail(err)
+	}
+
+	n := 0
+	err = tomato.WalkDir(opts.FS, "pages", func(fname string) error {
+		if !strings.HasSuffix(fname, ".md") {
+			return nil
+		}
+		fpath := filepath.Join(opts.InputDir, filepath.FromSlash(fname))
+		src, err := os.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		fm, content, err := tomato.ParseFrontMatter(src)
+		if err != nil {
+			return fmt.Errorf("%v: %v", fpath, err)
+		}
+		if fm.Format != tomato.FrontMatterLegacy {
+			return nil
+		}
+
+		header, err := fm.YAML()
+		if err != nil {
+			return fmt.Errorf("%v: %v", fpath, err)
+		}
+		n++
+		printf(opts, "Converting %v", fpath)
+		if *dryRun {
+			return nil
+		}
+		fi, err := os.Stat(fpath)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(fpath, append(append(header, '\n'), content...), fi.Mode().Perm())
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if *dryRun {
+		section(opts, "%v pages to convert.", n)
+	} else {
+		section(opts, "%v pages converted.", n)
+	}
+	return 0
+}
+
+// i18nCommand dispatches the translation subcommands, only `status` for now.
+func i18nCommand(args []string) int {
+	if len(args) == 0 || args[0] != "status" {
+		fmt.Fprint(os.Stderr, "Usage: tomato i18n status [flags] <input>\n")
+		return 2
+	}
+	return i18nStatusCommand(args[1:])
+}
+
+// i18nStatusCommand reports the pages, category names and template strings missing from each locale,
+// and writes stubs for them with --write-stubs.
+func i18nStatusCommand(args []string) int {
+	var cf commandFlags
+	fs := newFlagSet("i18n status", "i18n status [flags] <input>", &cf)
+	jsonOutput := fs.Bool("json", false, "print the report as JSON")
+	writeStubs := fs.Bool("write-stubs", false, "write draft pages, catinfo.stubs.json files and locale strings for the missing translations, copied from the default locale")
+	positional, status := parseFlags(fs, args)
+	if positional == nil {
+		return status
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := cf.options(positional[0])
+	if err != nil {
+		return fail(err)
+	}
+
+	report, err := tomato.CheckTranslations(context.Background(), opts)
+	if err != nil {
+		return fail(err)
+	}
+	if *jsonOutput {
+		data, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, l := range report.Locales {
+			fmt.Printf("%v: %v/%v pages, %v/%v categories, %v/%v strings\n", l.Locale,
+				l.Pages-len(l.MissingPages), l.Pages,
+				l.Categories-len(l.MissingCategories), l.Categories,
+				l.Strings-len(l.MissingStrings), l.Strings)
+			for _, missing := range [][]string{l.MissingPages, l.MissingCategories, l.MissingStrings} {
+				for _, name := range missing {
+					fmt.Printf("\tmissing %v\n", name)
+				}
+			}
+		}
+	}
+	if !*writeStubs {
+		return 0
+	}
+
+	var names []string
+	for name := range report.Stubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fpath := filepath.Join(opts.InputDir, filepath.FromSlash(name))
+		// stubs files are rewritten, but files of the user, like pages, are never overwritten
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if strings.Contains(path.Base(name), ".stubs.") {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		f, err := os.OpenFile(fpath, flags, 0664)
+		if err != nil {
+			return fail(err)
+		}
+		_, err = f.Write(report.Stubs[name])
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fail(err)
+		}
+		printf(opts, "Wrote %v", fpath)
+	}
+	section(opts, "%v stubs written.", len(names))
+	return 0
+}
@@ -0,0 +1,175 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ribacq/tomato"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "site")
+	writeFiles(t, input, testSite)
+	testCases := []struct {
+		args       []string
+		want       int
+		wantOutput string
+	}{
+		{nil, 2, ""},
+		{[]string{"--help"}, 0, ""},
+		{[]string{"help"}, 0, ""},
+		{[]string{"build", "--help"}, 0, ""},
+		{[]string{"i18n"}, 2, ""},
+		{[]string{"frobnicate"}, 2, ""},
+		{[]string{"--frobnicate"}, 2, ""},
+		{[]string{"build", "--frobnicate", input}, 2, ""},
+		{[]string{"build", "--quiet"}, 2, ""},
+		{[]string{"build", "--quiet", input, "extra"}, 2, ""},
+		{[]string{"build", "--quiet", "--verbose", input}, 2, ""},
+		{[]string{"build", filepath.Join(dir, "missing"), "--quiet"}, 1, ""},
+		{[]string{"build", input, "--quiet", "--output", filepath.Join(dir, "out1")}, 0, "out1"},
+		{[]string{"build", "--output", filepath.Join(dir, "out2"), input, "--quiet"}, 0, "out2"},
+		{[]string{input, filepath.Join(dir, "out3")}, 0, "out3"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := run(tc.args); got != tc.want {
+				t.Errorf("got exit status %v; want %v", got, tc.want)
+			}
+			if tc.wantOutput != "" && !tomato.FileExists(filepath.Join(dir, tc.wantOutput, "index.html")) {
+				t.Errorf("got no %v/index.html; want the website built there", tc.wantOutput)
+			}
+		})
+	}
+}
+
+func TestRun_foreignOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "site")
+	writeFiles(t, input, testSite)
+	writeFiles(t, input, map[string]string{"pages/blog/catinfo.json": `{"name": "Blog"}`})
+	writeFiles(t, dir, map[string]string{"site_html/notes.txt": "precious"})
+	// only building or serving to the default output directory writes there
+	testCases := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"check", "--quiet", input}, 0},
+		{[]string{"i18n", "status", "--quiet", input}, 0},
+		{[]string{"convert", "--quiet", "--dry-run", input}, 0},
+		{[]string{"new", "--quiet", input, "blog/post"}, 0},
+		{[]string{"build", "--quiet", "--output", filepath.Join(dir, "site.zip"), input}, 0},
+		{[]string{"build", "--quiet", input}, 1},
+		{[]string{"serve", "--quiet", input}, 1},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := run(tc.args); got != tc.want {
+				t.Errorf("got exit status %v; want %v", got, tc.want)
+			}
+		})
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "site_html", "notes.txt")); err != nil || string(got) != "precious" {
+		t.Errorf("got notes.txt = %q, %v; want it untouched", got, err)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	testCases := []struct {
+		args           []string
+		wantPositional []string
+		wantStatus     int
+		wantQuiet      bool
+		wantLocale     string
+	}{
+		{[]string{"a"}, []string{"a"}, -1, false, ""},
+		{[]string{"a", "--quiet", "b"}, []string{"a", "b"}, -1, true, ""},
+		{[]string{"--locale", "en,fr", "a", "--quiet"}, []string{"a"}, -1, true, "en,fr"},
+		{[]string{"a", "--", "--quiet"}, []string{"a", "--quiet"}, -1, false, ""},
+		{[]string{}, []string{}, -1, false, ""},
+		{[]string{"--help"}, nil, 0, false, ""},
+		{[]string{"a", "--nope"}, nil, 2, false, ""},
+		{[]string{"--quiet", "a", "--verbose"}, nil, 2, true, ""},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			var cf commandFlags
+			fs := newFlagSet("test", "test [flags] <input>", &cf)
+			positional, status := parseFlags(fs, tc.args)
+			if !reflect.DeepEqual(positional, tc.wantPositional) || status != tc.wantStatus {
+				t.Errorf("got %q, %v; want %q, %v", positional, status, tc.wantPositional, tc.wantStatus)
+			}
+			if cf.quiet != tc.wantQuiet || cf.locale != tc.wantLocale {
+				t.Errorf("got quiet = %v, locale = %q; want %v, %q", cf.quiet, cf.locale, tc.wantQuiet, tc.wantLocale)
+			}
+		})
+	}
+}
+
+func TestNewCommand(t *testing.T) {
+	input := t.TempDir()
+	writeFiles(t, input, testSite)
+	writeFiles(t, input, map[string]string{"pages/blog/catinfo.json": `{"name": "Blog"}`})
+	testCases := []struct {
+		page     string
+		want     int
+		wantFile string
+	}{
+		{"blog/my-first-post", 0, "pages/blog/my-first-post.en.md"},
+		{"blog/my-first-post.en.md", 1, ""},
+		{"notes/idea.en.md", 1, ""},
+		{"00.about.en.md", 0, "pages/00.about.en.md"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := newCommand([]string{"--quiet", input, tc.page}); got != tc.want {
+				t.Errorf("got exit status %v; want %v", got, tc.want)
+			}
+			if tc.wantFile == "" {
+				return
+			}
+			content, err := os.ReadFile(filepath.Join(input, filepath.FromSlash(tc.wantFile)))
+			if err != nil || !strings.Contains(string(content), "draft: true") {
+				t.Errorf("got %v = %q, %v; want a draft", tc.wantFile, content, err)
+			}
+		})
+	}
+}
+
+func TestI18nStatusCommand(t *testing.T) {
+	input := t.TempDir()
+	catinfo := `{"en": {"name": "Blog"}}`
+	writeFiles(t, input, map[string]string{
+		"siteinfo.json":            `{"locales": {"en": {"path": "/"}, "fr": {"path": "/fr"}}}`,
+		"pages/catinfo.json":       `{"name": "Home"}`,
+		"pages/index.en.md":        "# Home",
+		"pages/index.fr.md":        "# Accueil",
+		"pages/blog/catinfo.json":  catinfo,
+		"pages/blog/post.en.md":    "# Post",
+		"templates/page.html":      testSite["templates/page.html"],
+		"templates/locales/en.yml": "en:\n    locale_name: English\n",
+		"templates/locales/fr.yml": "fr:\n    locale_name: Français\n",
+	})
+	for i := 0; i < 2; i++ {
+		if got := i18nStatusCommand([]string{"--quiet", "--write-stubs", input}); got != 0 {
+			t.Fatalf("run %v: got exit status %v; want 0", i, got)
+		}
+	}
+	if got, err := os.ReadFile(filepath.Join(input, "pages", "blog", "catinfo.json")); err != nil || string(got) != catinfo {
+		t.Errorf("got catinfo.json = %q, %v; want it unchanged", got, err)
+	}
+	for _, name := range []string{"pages/blog/catinfo.stubs.json", "pages/blog/post.fr.md"} {
+		if !tomato.FileExists(filepath.Join(input, filepath.FromSlash(name))) {
+			t.Errorf("got no %v; want a stub", name)
+		}
+	}
+}
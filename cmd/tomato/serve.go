@@ -0,0 +1,258 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ribacq/tomato"
+)
+
+const (
+	defaultServeAddress = "localhost:8080"
+	livereloadPath      = "/_tomato/livereload"
+	watchInterval       = 500 * time.Millisecond
+)
+
+// livereloadScript is injected in every html file served by `tomato serve`.
+// It reloads the page as soon as the server announces a new build,
+// and shows the error on top of the page when a rebuild fails.
+const livereloadScript = `<script>
+(function() {
+	var source = new EventSource("` + livereloadPath + `");
+	source.addEventListener("reload", function() { location.reload(); });
+	source.addEventListener("builderror", function(e) {
+		var pre = document.getElementById("tomato-build-error") || document.createElement("pre");
+		pre.id = "tomato-build-error";
+		pre.style.cssText = "position: fixed; top: 0; left: 0; right: 0; z-index: 10000; margin: 0; padding: 1em; white-space: pre-wrap; background: #fdd; color: #900;";
+		pre.textContent = "Build failed, showing the previous build:\n" + e.data;
+		document.body.appendChild(pre);
+	});
+})();
+</script>
+`
+
+// watchedPaths are the paths in the input directory whose changes trigger a rebuild.
+var watchedPaths = []string{"pages", "templates", "assets", "media", "siteinfo.json"}
+
+// serve builds the website, serves it on the given address and rebuilds it whenever the input changes.
+// Open browser tabs are reloaded after every successful rebuild.
+// A failed rebuild leaves the previous build in place, and its error is shown in the open browser tabs.
+func serve(opts tomato.Options, addr string) error {
+	_, err := tomato.Build(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	reloader := newReloader()
+	go watch(context.Background(), opts.InputDir, opts.ConfigPath, watchInterval, func() {
+		section(opts, "Change detected, rebuilding...")
+		rebuild(opts, reloader)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle(livereloadPath, reloader)
+	mux.Handle("/", livereloadHandler{dir: opts.OutputDir, files: http.FileServer(http.Dir(opts.OutputDir))})
+
+	section(opts, "Serving %v on http://%v/", opts.OutputDir, addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// livereloadHandler serves files from dir, injecting the livereload script in html files.
+type livereloadHandler struct {
+	dir   string
+	files http.Handler
+}
+
+func (h livereloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+	fpath := filepath.Join(h.dir, filepath.FromSlash(name))
+	if tomato.DirectoryExists(fpath) {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			h.files.ServeHTTP(w, r)
+			return
+		}
+		fpath = filepath.Join(fpath, "index.html")
+	}
+	if !strings.HasSuffix(fpath, ".html") || !tomato.FileExists(fpath) {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+
+	content, err := tomato.ReadFile(fpath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(injectLivereload(content))
+}
+
+// rebuild builds the website again, then tells the clients of reloader to reload,
+// or shows them the error if the build failed.
+func rebuild(opts tomato.Options, reloader *reloader) {
+	if _, err := tomato.Build(context.Background(), opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		reloader.broadcast(event{"builderror", err.Error()})
+		return
+	}
+	reloader.broadcast(event{"reload", "reload"})
+}
+
+// injectLivereload inserts the livereload script just before the closing body tag,
+// or at the end of the document if there is none.
+func injectLivereload(content []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(content), []byte("</body>"))
+	if i < 0 {
+		return append(content, livereloadScript...)
+	}
+	ret := make([]byte, 0, len(content)+len(livereloadScript))
+	ret = append(ret, content[:i]...)
+	ret = append(ret, livereloadScript...)
+	return append(ret, content[i:]...)
+}
+
+// event is a server-sent event, named and carrying some text.
+type event struct {
+	name, data string
+}
+
+// String formats the event for a text/event-stream, one data field per line of text.
+func (e event) String() string {
+	str := "event: " + e.name + "\n"
+	for _, line := range strings.Split(e.data, "\n") {
+		str += "data: " + line + "\n"
+	}
+	return str + "\n"
+}
+
+// reloader keeps track of open browser tabs and tells them when to reload, using server-sent events.
+type reloader struct {
+	mutex   sync.Mutex
+	clients map[chan event]bool
+}
+
+func newReloader() *reloader {
+	return &reloader{clients: make(map[chan event]bool)}
+}
+
+// subscribe registers a new client, and returns its channel of events and the function removing it.
+func (rl *reloader) subscribe() (chan event, func()) {
+	client := make(chan event, 1)
+	rl.mutex.Lock()
+	rl.clients[client] = true
+	rl.mutex.Unlock()
+	return client, func() {
+		rl.mutex.Lock()
+		delete(rl.clients, client)
+		rl.mutex.Unlock()
+	}
+}
+
+// broadcast sends an event to all connected clients.
+// Clients that did not read the previous event yet skip this one.
+func (rl *reloader) broadcast(e event) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	for client := range rl.clients {
+		select {
+		case client <- e:
+		default:
+		}
+	}
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client, unsubscribe := rl.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case e := <-client:
+			fmt.Fprint(w, e)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// watch polls the watched paths of inputDir and the config file every interval,
+// and calls onChange whenever a file is created, modified or deleted.
+// It returns once ctx is done.
+func watch(ctx context.Context, inputDir, configPath string, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := snapshot(inputDir, configPath)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := snapshot(inputDir, configPath)
+		if !sameSnapshot(last, cur) {
+			onChange()
+		}
+		last = cur
+	}
+}
+
+// fileState is what is compared between two polls of a file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot returns the state of every file under the watched paths of inputDir, and of the config file.
+func snapshot(inputDir, configPath string) map[string]fileState {
+	files := make(map[string]fileState)
+	roots := []string{configPath}
+	for _, name := range watchedPaths {
+		roots = append(roots, filepath.Join(inputDir, name))
+	}
+	for _, root := range roots {
+		filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				files[fpath] = fileState{info.ModTime(), info.Size()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// sameSnapshot returns whether two snapshots describe the same files.
+func sameSnapshot(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for fpath, state := range a {
+		if b[fpath] != state {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ribacq/tomato"
+)
+
+// writeFiles writes files, by slash-separated path, under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testSite is a minimal website.
+var testSite = map[string]string{
+	"siteinfo.json":            `{"locales": {"en": {"path": "/"}}}`,
+	"pages/catinfo.json":       `{"name": "Home"}`,
+	"pages/index.en.md":        "# Home",
+	"templates/page.html":      `{{ define "Header" }}<body>{{ end }}{{ define "Footer" }}</body>{{ end }}{{ define "PageList" }}{{ end }}`,
+	"templates/locales/en.yml": "en:\n    locale_name: English\n",
+}
+
+func TestInjectLivereload(t *testing.T) {
+	testCases := []struct {
+		content, want string
+	}{
+		{"<body><p>a</p></body></html>", "<body><p>a</p>" + livereloadScript + "</body></html>"},
+		{"<p>a</p>", "<p>a</p>" + livereloadScript},
+		{"<BODY><p>a</p></BODY>", "<BODY><p>a</p>" + livereloadScript + "</BODY>"},
+		{"<body><pre>&lt;/body&gt;</pre></body>", "<body><pre>&lt;/body&gt;</pre>" + livereloadScript + "</body>"},
+		{"", livereloadScript},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := string(injectLivereload([]byte(tc.content))); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLivereloadHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":     "<body></body>",
+		"blog/post.html": "<body></body>",
+		"assets/a.css":   "body {}",
+		"assets/a.js":    "var a;",
+		"search.json":    "{}",
+		"feed.xml":       "<rss></rss>",
+	})
+	h := livereloadHandler{dir: dir, files: http.FileServer(http.Dir(dir))}
+	testCases := []struct {
+		url         string
+		wantScript  bool
+		contentType string
+	}{
+		{"/", true, "text/html"},
+		{"/blog/post.html", true, "text/html"},
+		{"/assets/a.css", false, "text/css"},
+		{"/assets/a.js", false, "javascript"},
+		{"/search.json", false, "application/json"},
+		{"/feed.xml", false, "xml"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+			if got := strings.Contains(w.Body.String(), livereloadScript); got != tc.wantScript {
+				t.Errorf("got script injected = %v; want %v in %q", got, tc.wantScript, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); !strings.Contains(got, tc.contentType) {
+				t.Errorf("got Content-Type %q; want %q", got, tc.contentType)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, testSite)
+	var changes int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watch(ctx, dir, filepath.Join(dir, "siteinfo.json"), 10*time.Millisecond, func() { atomic.AddInt32(&changes, 1) })
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	wait := func(want int32) {
+		t.Helper()
+		time.Sleep(100 * time.Millisecond)
+		if got := atomic.LoadInt32(&changes); got != want {
+			t.Errorf("got %v rebuilds; want %v", got, want)
+		}
+	}
+
+	wait(0)
+	writeFiles(t, dir, map[string]string{"pages/post.en.md": "# Post"})
+	wait(1)
+	writeFiles(t, dir, map[string]string{"notes.txt": "not watched"})
+	wait(1)
+	if err := os.Remove(filepath.Join(dir, "pages", "post.en.md")); err != nil {
+		t.Fatal(err)
+	}
+	wait(2)
+}
+
+func TestRebuild(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, testSite)
+	opts := tomato.Options{InputDir: dir, OutputDir: filepath.Join(dir, "out")}
+	if _, err := tomato.Build(context.Background(), opts); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	rl := newReloader()
+	client, unsubscribe := rl.subscribe()
+	defer unsubscribe()
+
+	// a failed rebuild keeps the previous build, and shows the error
+	writeFiles(t, dir, map[string]string{"pages/index.en.md": "---\ndate: never\n---\n# Home"})
+	rebuild(opts, rl)
+	if e := <-client; e.name != "builderror" || !strings.Contains(e.data, "date") {
+		t.Errorf("got event %+v; want a builderror event with the error", e)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "out", "index.html")); err != nil || !strings.Contains(string(got), "Home") {
+		t.Errorf("got index.html = %q, %v; want the previous build", got, err)
+	}
+
+	// a successful rebuild reloads
+	writeFiles(t, dir, map[string]string{"pages/index.en.md": "# Welcome"})
+	rebuild(opts, rl)
+	if e := <-client; e.name != "reload" {
+		t.Errorf("got event %+v; want a reload event", e)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "out", "index.html")); err != nil || !strings.Contains(string(got), "Welcome") {
+		t.Errorf("got index.html = %q, %v; want the new build", got, err)
+	}
+}
+
+func TestEvent_String(t *testing.T) {
+	testCases := []struct {
+		e    event
+		want string
+	}{
+		{event{"reload", "reload"}, "event: reload\ndata: reload\n\n"},
+		{event{"builderror", "a\nb"}, "event: builderror\ndata: a\ndata: b\n\n"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := tc.e.String(); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestServeCommand_archive(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, testSite)
+	if got := serveCommand([]string{"--quiet", "--output", filepath.Join(dir, "site.zip"), dir}); got != 1 {
+		t.Errorf("got exit status %v; want 1", got)
+	}
+	if tomato.FileExists(filepath.Join(dir, "site.zip")) {
+		t.Errorf("got site.zip created; want nothing written")
+	}
+}
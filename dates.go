@@ -0,0 +1,129 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qor/i18n"
+)
+
+// dateLayouts are the layouts accepted for the dates of pages, with an optional time of day and timezone.
+// Dates without a timezone are in that of the website.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05Z07:00",
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+}
+
+// parseDate parses the date of a page in one of the dateLayouts, in loc unless it has a timezone.
+// An empty date is the zero time.
+func parseDate(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD with an optional time like 15:04 and timezone like +02:00", s)
+}
+
+// defaultDateStyle is the format of formatDate when the locale files give none.
+const defaultDateStyle = "long"
+
+// formatDate formats a date in a locale, in a format that is either a CLDR style of dateStyles, like "long",
+// or a time.Format layout, like "2 January 2006". It defaults to the format given by the `dates.format` key
+// of the locale files, or else to defaultDateStyle. In layouts, the names of months and days are those of monthName
+// and dayName. The zero time is formatted as "".
+func formatDate(locales *i18n.I18n, locale string, t time.Time, format ...string) string {
+	if t.IsZero() {
+		return ""
+	}
+	f := defaultDateStyle
+	if len(format) > 0 {
+		f = format[0]
+	} else if locales != nil {
+		if translation := string(locales.T(locale, "dates.format")); translation != "" {
+			f = translation
+		}
+	}
+
+	if style, ok := dateStyles[f]; ok {
+		loc, _ := cldrLocale(locale)
+		if str, err := style(loc.Calendar, t); err == nil {
+			return str
+		}
+		f = t.Format(time.RFC3339)
+	}
+
+	names := map[string]string{
+		"January": monthName(locales, locale, t.Month()),
+		"Monday":  dayName(locales, locale, t.Weekday()),
+	}
+	var b strings.Builder
+	for f != "" {
+		i, token := -1, ""
+		for name := range names {
+			if j := strings.Index(f, name); j >= 0 && (i < 0 || j < i) {
+				i, token = j, name
+			}
+		}
+		if i < 0 {
+			b.WriteString(t.Format(f))
+			break
+		}
+		b.WriteString(t.Format(f[:i]))
+		b.WriteString(names[token])
+		f = f[i+len(token):]
+	}
+	return b.String()
+}
+
+// monthName returns the name of a month in a locale: the `dates.months.<month>` key of the locale files,
+// like `dates.months.may`, or else the CLDR name.
+func monthName(locales *i18n.I18n, locale string, month time.Month) string {
+	loc, _ := cldrLocale(locale)
+	name, _ := loc.Calendar.Format(time.Date(2000, month, 1, 0, 0, 0, 0, time.UTC), "MMMM")
+	return translatedName(locales, locale, "dates.months."+strings.ToLower(month.String()), name)
+}
+
+// dayName returns the name of a day of the week in a locale: the `dates.days.<day>` key of the locale files,
+// like `dates.days.monday`, or else the CLDR name.
+func dayName(locales *i18n.I18n, locale string, day time.Weekday) string {
+	loc, _ := cldrLocale(locale)
+	// the 2nd of January 2000 was a Sunday
+	name, _ := loc.Calendar.Format(time.Date(2000, 1, 2+int(day), 0, 0, 0, 0, time.UTC), "EEEE")
+	return translatedName(locales, locale, "dates.days."+strings.ToLower(day.String()), name)
+}
+
+// translatedName returns the translation of key, or name if there is none.
+func translatedName(locales *i18n.I18n, locale, key, name string) string {
+	if locales != nil {
+		if translation := string(locales.T(locale, key)); translation != "" {
+			return translation
+		}
+	}
+	return name
+}
+
+// location returns the timezone of the website, UTC by default.
+func (siteinfo Siteinfo) location() *time.Location {
+	if siteinfo.loc == nil {
+		return time.UTC
+	}
+	return siteinfo.loc
+}
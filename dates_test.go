@@ -0,0 +1,179 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	paris := time.FixedZone("Paris", 2*60*60)
+	testCases := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2018-06-02", time.Date(2018, 6, 2, 0, 0, 0, 0, paris), false},
+		{" 2018-06-02 ", time.Date(2018, 6, 2, 0, 0, 0, 0, paris), false},
+		{"2018-06-02 14:30", time.Date(2018, 6, 2, 14, 30, 0, 0, paris), false},
+		{"2018-06-02T14:30:15", time.Date(2018, 6, 2, 14, 30, 15, 0, paris), false},
+		{"2018-06-02T14:30:15Z", time.Date(2018, 6, 2, 14, 30, 15, 0, time.UTC), false},
+		{"2018-06-02 14:30-05:00", time.Date(2018, 6, 2, 19, 30, 0, 0, time.UTC), false},
+		{"2018-06-02 14:30:15 +0000", time.Date(2018, 6, 2, 14, 30, 15, 0, time.UTC), false},
+		{"02/06/2018", time.Time{}, true},
+		{"2018-13-02", time.Time{}, true},
+		{"hello", time.Time{}, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			got, err := parseDate(tc.s, paris)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got err = %v; want error: %v", err, tc.wantErr)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	locales, err := LoadLocales(fstest.MapFS{
+		"en.yml": {Data: []byte("en:\n    dates:\n        format: \"January 2, 2006\"\n")},
+		"fr.yml": {Data: []byte("fr:\n    dates:\n        months:\n            june: juin\n        days:\n            saturday: samedi\n")},
+	}, ".")
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	date := time.Date(2018, 6, 2, 14, 30, 0, 0, time.UTC)
+	testCases := []struct {
+		locale string
+		date   time.Time
+		format []string
+		want   string
+	}{
+		{"en", date, nil, "June 2, 2018"},
+		{"fr", date, nil, "2 juin 2018"},
+		{"fr", date, []string{"Monday 2 January 2006, 15:04"}, "samedi 2 juin 2018, 14:30"},
+		{"fr", date, []string{"2006-01-02"}, "2018-06-02"},
+		{"fr", date, []string{"full"}, "samedi 2 juin 2018"},
+		{"fr", date, []string{"short"}, "02/06/2018"},
+		{"de", date, nil, "2. Juni 2018"},
+		{"es", date, []string{"datetime-long"}, "2 de junio de 2018, 14:30:00"},
+		{"en", date, []string{"medium"}, "Jun 2, 2018"},
+		{"fr", date, []string{"Monday 2 Jan"}, "samedi 2 Jun"},
+		{"fr", time.Time{}, nil, ""},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := formatDate(locales, tc.locale, tc.date, tc.format...); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadSite_dates(t *testing.T) {
+	input := func(date string) fstest.MapFS {
+		return fstest.MapFS{
+			"siteinfo.json":            {Data: []byte(`{"locales": {"en": {"path": "/"}}, "timezone": "UTC"}`)},
+			"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+			"pages/post.en.md":         {Data: []byte("---\n" + date + "\n---\n# Post")},
+			"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+			"templates/locales/en.yml": {Data: []byte("en:\n    locale_name: English\n")},
+		}
+	}
+
+	s, err := LoadSite(context.Background(), Options{FS: input("date: 2018-06-02 10:00\nupdated: 2018-06-05"), Output: NewMapOutput()})
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	page := s.Tree.Locales["en"].Pages[0]
+	if want := time.Date(2018, 6, 2, 10, 0, 0, 0, time.UTC); !page.Date.Equal(want) {
+		t.Errorf("got date %v; want %v", page.Date, want)
+	}
+	if want := time.Date(2018, 6, 5, 0, 0, 0, 0, time.UTC); !page.Updated.Equal(want) || !page.lastModified().Equal(want) {
+		t.Errorf("got updated %v; want %v", page.Updated, want)
+	}
+
+	for _, date := range []string{"date: yesterday", "updated: 2018-02-30"} {
+		_, err := LoadSite(context.Background(), Options{FS: input(date), Output: NewMapOutput()})
+		if err == nil || !strings.Contains(err.Error(), "pages/post.en.md") {
+			t.Errorf("%v: got err = %v; want an error with the path of the page", date, err)
+		}
+	}
+}
+
+func TestBuild_schedule(t *testing.T) {
+	input := func(expired string) fstest.MapFS {
+		return fstest.MapFS{
+			"siteinfo.json":            {Data: []byte(`{"locales": {"en": {"path": "/"}}, "timezone": "UTC"` + expired + `}`)},
+			"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+			"pages/past.md":            {Data: []byte("---\ndate: 2018-06-01\n---\n# Past")},
+			"pages/future.md":          {Data: []byte("---\ndate: 2018-06-03\n---\n# Future")},
+			"pages/expired.md":         {Data: []byte("---\ndate: 2018-05-01\nexpires: 2018-06-02 09:00\n---\n# Expired")},
+			"pages/expiring.md":        {Data: []byte("---\ndate: 2018-05-01\nexpires: 2018-06-02 11:00\n---\n# Expiring")},
+			"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+			"templates/locales/en.yml": {Data: []byte("en:\n    locale_name: English\n")},
+		}
+	}
+	now := time.Date(2018, 6, 2, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		future      bool
+		expired     string
+		wantFiles   []string
+		wantListed  []string
+		wantFuture  []string
+		wantExpired []string
+	}{
+		{false, "", []string{"past.html", "expiring.html"}, []string{"Past", "Expiring"}, []string{"pages/future.md"}, []string{"pages/expired.md"}},
+		{true, "", []string{"past.html", "future.html", "expiring.html"}, []string{"Future", "Past", "Expiring"}, nil, []string{"pages/expired.md"}},
+		{false, `, "expired": "unlist"`, []string{"past.html", "expired.html", "expiring.html"}, []string{"Past", "Expiring"}, []string{"pages/future.md"}, []string{"pages/expired.md"}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			out := NewMapOutput()
+			res, err := Build(context.Background(), Options{FS: input(tc.expired), Output: out, Future: tc.future, Now: now})
+			if err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			for _, name := range []string{"past.html", "future.html", "expired.html", "expiring.html"} {
+				_, got := out.Files()[name]
+				want := false
+				for _, wantName := range tc.wantFiles {
+					want = want || wantName == name
+				}
+				if got != want {
+					t.Errorf("%v: got generated = %v; want %v", name, got, want)
+				}
+			}
+			var listed []string
+			s, err := LoadSite(context.Background(), Options{FS: input(tc.expired), Output: NewMapOutput(), Future: tc.future, Now: now})
+			if err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			for _, page := range s.Tree.RecentPages(-1, "en") {
+				listed = append(listed, page.Title)
+			}
+			if !reflect.DeepEqual(listed, tc.wantListed) {
+				t.Errorf("got listed pages %v; want %v", listed, tc.wantListed)
+			}
+			if !reflect.DeepEqual(res.Future, tc.wantFuture) || !reflect.DeepEqual(res.Expired, tc.wantExpired) {
+				t.Errorf("got held back %v and %v; want %v and %v", res.Future, res.Expired, tc.wantFuture, tc.wantExpired)
+			}
+		})
+	}
+
+	if _, err := LoadSite(context.Background(), Options{FS: input(`, "expired": "hide"`), Output: NewMapOutput()}); err == nil {
+		t.Errorf("got err = nil; want an error for an unknown expired value")
+	}
+}
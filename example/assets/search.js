@@ -0,0 +1,84 @@
+// search the pages of the search.json index generated by tomato
+(function() {
+	const form = document.getElementById('search')
+	const input = document.getElementById('search-query')
+	const results = document.getElementById('search-results')
+	let index = null
+
+	// split a text into lower case words of letters and digits, like tomato does
+	function words(text) {
+		return text.toLowerCase().split(/[^\p{L}\p{N}]+/u).filter(w => w.length > 0)
+	}
+
+	// pages matching a word, as a set of positions in index.pages
+	function matches(word) {
+		const found = new Set()
+		const add = ids => ids.forEach(id => found.add(id))
+		if (!index.kind) {
+			index.pages.forEach((page, id) => {
+				const text = [page.title, page.text, ...(page.tags || []), ...(page.authors || [])].join(' ')
+				if (words(text).some(w => w.includes(word))) {
+					found.add(id)
+				}
+			})
+		} else if (word.length <= index.length) {
+			// short words are only found as keys on their own, or at the beginning of keys
+			for (const key in index.index) {
+				if (index.kind === 'prefix' ? key.startsWith(word) : key.includes(word)) {
+					add(index.index[key])
+				}
+			}
+		} else if (index.kind === 'prefix') {
+			add(index.index[[...word].slice(0, index.maxLength).join('')] || [])
+		} else {
+			// pages having all the n-grams of the word
+			const chars = [...word]
+			let ids = null
+			for (let i = 0; i + index.length <= chars.length; i++) {
+				const gram = new Set(index.index[chars.slice(i, i + index.length).join('')] || [])
+				ids = ids === null ? gram : new Set([...ids].filter(id => gram.has(id)))
+			}
+			add(ids)
+		}
+		return found
+	}
+
+	function search() {
+		results.innerHTML = ''
+		const query = words(input.value)
+		if (index === null || query.length === 0) {
+			return
+		}
+		let ids = null
+		for (const word of query) {
+			const found = matches(word)
+			ids = ids === null ? found : new Set([...ids].filter(id => found.has(id)))
+		}
+		if (ids.size === 0) {
+			const li = document.createElement('li')
+			li.textContent = results.dataset.none
+			results.appendChild(li)
+			return
+		}
+		for (const id of ids) {
+			const page = index.pages[id]
+			const li = document.createElement('li')
+			const a = document.createElement('a')
+			a.href = form.dataset.root + page.path
+			a.textContent = page.title
+			li.appendChild(a)
+			if (page.date) {
+				li.appendChild(document.createTextNode(' — ' + page.date))
+			}
+			results.appendChild(li)
+		}
+	}
+
+	fetch(form.dataset.index)
+		.then(response => response.json())
+		.then(data => {
+			index = data
+			search()
+		})
+	input.addEventListener('input', search)
+})()
@@ -0,0 +1,470 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Feed formats, and the names of their files in the directory of a category.
+const (
+	FeedRSS  = "rss"
+	FeedAtom = "atom"
+	FeedJSON = "json"
+)
+
+var feedFiles = map[string]string{
+	FeedRSS:  "feed.xml",
+	FeedAtom: "atom.xml",
+	FeedJSON: "feed.json",
+}
+
+var feedTypes = map[string]string{
+	FeedRSS:  "application/rss+xml",
+	FeedAtom: "application/atom+xml",
+	FeedJSON: "application/feed+json",
+}
+
+// FeedConfig is the `feeds` object of siteinfo.json.
+// Formats lists the generated formats among rss, atom and json, all of them by default.
+// Items is the number of pages in each feed, 20 by default.
+// If FullContent is set, items hold the whole page instead of its excerpt.
+// Feeds are generated for the root of each locale, every listed category, every tag and every author,
+// only if the base URL of the locale is known, since they need absolute URLs.
+type FeedConfig struct {
+	Formats     []string `json:"formats"`
+	Items       int      `json:"items"`
+	FullContent bool     `json:"fullContent"`
+}
+
+// formats returns the configured formats, or all of them.
+func (fc FeedConfig) formats() []string {
+	if len(fc.Formats) == 0 {
+		return []string{FeedRSS, FeedAtom, FeedJSON}
+	}
+	return fc.Formats
+}
+
+// items returns the configured number of items, or the default one.
+func (fc FeedConfig) items() int {
+	if fc.Items <= 0 {
+		return 20
+	}
+	return fc.Items
+}
+
+// check returns an error if a format is unknown.
+func (fc FeedConfig) check() error {
+	for _, format := range fc.Formats {
+		if _, ok := feedFiles[format]; !ok {
+			return fmt.Errorf("unknown feed format %q, want rss, atom or json", format)
+		}
+	}
+	return nil
+}
+
+// hasFeed tells whether a category gets feeds: the root, listed categories with pages to publish,
+// and tags and authors with pages to publish. The archive has none.
+func (cat *Category) hasFeed(locale string) bool {
+	if cat.Parent == nil {
+		return true
+	}
+	if archiveCat := cat.ArchiveCategory(); archiveCat != nil && cat.IsUnder(archiveCat) {
+		return false
+	}
+	if cat.Virtual && !cat.Parent.Virtual || !cat.Virtual && cat.Locales[locale].Unlisted {
+		return false
+	}
+	return len(cat.feedPages(locale)) > 0
+}
+
+// feedPages returns the pages of a category published in its feeds, most recent first.
+// Drafts shown in preview builds are never published, and untranslated pages are in the feeds of the default locale.
+func (cat *Category) feedPages(locale string) (pages []*Page) {
+	for _, page := range cat.RecentPages(-1, locale) {
+		if !page.Draft && !page.Untranslated {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// feedTitle returns the title of the feeds of a category.
+func (siteinfo Siteinfo) feedTitle(cat *Category, locale string) string {
+	if cat.Parent == nil {
+		return siteinfo.Locales[locale].Title
+	}
+	return siteinfo.Locales[locale].Title + " – " + cat.Locales[locale].Name
+}
+
+// FeedLinksHelper prints the html `<link rel="alternate">` tags for the feeds of the website in a locale,
+// and for those of the category of the page if it has its own.
+func (siteinfo Siteinfo) FeedLinksHelper(page *Page, locale string) string {
+	if siteinfo.baseURL(locale) == "" || page == nil || page.Category == nil {
+		return ""
+	}
+	cats := []*Category{page.Category.Tree()}
+	for cat := page.Category; cat.Parent != nil; cat = cat.Parent {
+		if cat.hasFeed(locale) {
+			cats = append(cats, cat)
+			break
+		}
+	}
+
+	var str string
+	for _, cat := range cats {
+		for _, format := range siteinfo.Feeds.formats() {
+			href := siteinfo.absoluteURL(locale, path.Join(siteinfo.Locales[locale].Path, cat.Path(locale), feedFiles[format]))
+			str += fmt.Sprintf("<link rel=\"alternate\" type=\"%s\" title=\"%s\" href=\"%s\">\n", feedTypes[format], html.EscapeString(siteinfo.feedTitle(cat, locale)), html.EscapeString(href))
+		}
+	}
+	return str
+}
+
+// feedItem is a page in a feed, independent of the format.
+type feedItem struct {
+	URL     string
+	Title   string
+	Date    time.Time
+	Updated time.Time
+	Authors []*Author
+	Tags    []string
+	Excerpt string
+	Content string
+}
+
+// feed is the content of a feed, independent of the format.
+type feed struct {
+	Title       string
+	Description string
+	Language    string
+	HomeURL     string
+	URL         string
+	Updated     time.Time
+	Items       []feedItem
+}
+
+// generateFeeds writes the feeds of every category of a locale that has them to out.
+func generateFeeds(s *Site, out Output, locale string, cache *buildCache) (n int, err error) {
+	if s.Siteinfo.baseURL(locale) == "" {
+		return 0, nil
+	}
+	localePath := s.Siteinfo.Locales[locale].Path
+	for catQueue := []*Category{s.Tree}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
+		cat := catQueue[0]
+		if !cat.hasFeed(locale) {
+			continue
+		}
+
+		var f *feed
+		for _, format := range s.Siteinfo.Feeds.formats() {
+			name := path.Join(localePath, cat.Path(locale), feedFiles[format])
+			if kept, err := cache.keep(name, cache.categoryKey(cat, locale, name)); kept || err != nil {
+				if err != nil {
+					return n, err
+				}
+				n++
+				continue
+			}
+
+			// the content is the same for all formats
+			if f == nil {
+				if f, err = newFeed(&s.Siteinfo, s.Tree, s.Templates, cat, locale); err != nil {
+					return n, err
+				}
+			}
+			f.URL = s.Siteinfo.absoluteURL(locale, name)
+			var data []byte
+			switch format {
+			case FeedRSS:
+				data, err = f.rss()
+			case FeedAtom:
+				data, err = f.atom()
+			case FeedJSON:
+				data, err = f.json()
+			}
+			if err != nil {
+				return n, err
+			}
+			if err := writeFile(out, name, data); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// newFeed gathers the recent pages of a category into a feed.
+// The feed URL, which depends on the format, is not set.
+func newFeed(siteinfo *Siteinfo, tree *Category, templates *template.Template, cat *Category, locale string) (*feed, error) {
+	f := &feed{
+		Title:       siteinfo.feedTitle(cat, locale),
+		Description: plainText(siteinfo.Locales[locale].Description),
+		Language:    locale,
+		HomeURL:     siteinfo.CategoryURLHelper(cat, locale),
+	}
+	if cat.Parent != nil && cat.Locales[locale].Description != "" {
+		f.Description = plainText(cat.Locales[locale].Description)
+	}
+
+	for _, page := range cat.feedPages(locale) {
+		if len(f.Items) == siteinfo.Feeds.items() {
+			break
+		}
+		item := feedItem{
+			URL:     siteinfo.PermalinkHelper(page, locale),
+			Title:   page.Title,
+			Authors: page.Authors,
+			Tags:    page.Tags,
+			Excerpt: strings.TrimSpace(page.Excerpt()),
+		}
+		item.Date, item.Updated = page.Date, page.lastModified()
+		if item.Updated.After(f.Updated) {
+			f.Updated = item.Updated
+		}
+		if siteinfo.Feeds.FullContent {
+			// links starting with a slash are made absolute, quotes are unescaped for templates like in ContentHelper
+			content := strings.Replace(string(htmlWithPrefix(page.Content, siteinfo.baseURL(locale))), "&quot;", "\"", -1)
+			data, err := renderPage(siteinfo, tree, templates, locale, page, content, "Content")
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", page.Path(), err)
+			}
+			item.Content = string(data)
+		}
+		f.Items = append(f.Items, item)
+	}
+	return f, nil
+}
+
+// plainText strips the markdown formatting of a short text.
+func plainText(md string) string {
+	return strings.TrimSpace(string(Raw([]byte(md))))
+}
+
+// rssFeed is the XML document of an RSS 2.0 feed.
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	AtomNS  string   `xml:"xmlns:atom,attr"`
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"language"`
+		AtomLink    struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"atom:link"`
+		LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+		Items         []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Authors     []string `xml:"author"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+// rss encodes the feed as RSS 2.0.
+func (f *feed) rss() ([]byte, error) {
+	var r rssFeed
+	r.Version, r.AtomNS = "2.0", "http://www.w3.org/2005/Atom"
+	r.Channel.Title, r.Channel.Link, r.Channel.Description, r.Channel.Language = f.Title, f.HomeURL, f.Description, f.Language
+	r.Channel.AtomLink.Href, r.Channel.AtomLink.Rel, r.Channel.AtomLink.Type = f.URL, "self", feedTypes[FeedRSS]
+	if !f.Updated.IsZero() {
+		r.Channel.LastBuildDate = f.Updated.Format(time.RFC1123Z)
+	}
+	for _, item := range f.Items {
+		ri := rssItem{Title: item.Title, Link: item.URL, GUID: item.URL, Categories: item.Tags, Description: item.Excerpt}
+		if !item.Date.IsZero() {
+			ri.PubDate = item.Date.Format(time.RFC1123Z)
+		}
+		for _, author := range item.Authors {
+			// RSS authors are email addresses
+			if author.Email != "" {
+				ri.Authors = append(ri.Authors, fmt.Sprintf("%s (%s)", author.Email, author.Name))
+			}
+		}
+		if item.Content != "" {
+			ri.Description = item.Content
+		}
+		r.Channel.Items = append(r.Channel.Items, ri)
+	}
+	return marshalXML(r)
+}
+
+// atomFeed is the XML document of an Atom feed.
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang     string      `xml:"xml:lang,attr"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Links    []atomLink  `xml:"link"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Authors    []atomAuthor   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    atomText       `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// atom encodes the feed as Atom.
+func (f *feed) atom() ([]byte, error) {
+	a := atomFeed{
+		Lang:     f.Language,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Links:    []atomLink{{Href: f.HomeURL, Rel: "alternate", Type: "text/html"}, {Href: f.URL, Rel: "self", Type: feedTypes[FeedAtom]}},
+		ID:       f.URL,
+		Updated:  f.Updated.Format(time.RFC3339),
+	}
+	for _, item := range f.Items {
+		e := atomEntry{
+			Title:   item.Title,
+			Link:    atomLink{Href: item.URL, Rel: "alternate", Type: "text/html"},
+			ID:      item.URL,
+			Updated: f.Updated.Format(time.RFC3339),
+			Summary: atomText{Type: "text", Text: item.Excerpt},
+		}
+		if !item.Date.IsZero() {
+			e.Published = item.Date.Format(time.RFC3339)
+		}
+		if !item.Updated.IsZero() {
+			e.Updated = item.Updated.Format(time.RFC3339)
+		}
+		for _, author := range item.Authors {
+			e.Authors = append(e.Authors, atomAuthor{Name: author.Name, Email: author.Email})
+		}
+		for _, tag := range item.Tags {
+			e.Categories = append(e.Categories, atomCategory{Term: tag})
+		}
+		if item.Content != "" {
+			e.Content = &atomText{Type: "html", Text: item.Content}
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return marshalXML(a)
+}
+
+// marshalXML encodes v as an indented XML document.
+func marshalXML(v interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// jsonFeed is a JSON Feed 1.1 document.
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	ContentText   string           `json:"content_text,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// json encodes the feed as JSON Feed 1.1.
+func (f *feed) json() ([]byte, error) {
+	j := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.URL,
+		Description: f.Description,
+		Language:    f.Language,
+		Items:       []jsonFeedItem{},
+	}
+	for _, item := range f.Items {
+		ji := jsonFeedItem{ID: item.URL, URL: item.URL, Title: item.Title, Summary: item.Excerpt, Tags: item.Tags}
+		if item.Content != "" {
+			ji.ContentHTML = item.Content
+		} else {
+			ji.ContentText = item.Excerpt
+		}
+		if !item.Date.IsZero() {
+			ji.DatePublished = item.Date.Format(time.RFC3339)
+		}
+		if item.Updated.After(item.Date) {
+			ji.DateModified = item.Updated.Format(time.RFC3339)
+		}
+		for _, author := range item.Authors {
+			ja := jsonFeedAuthor{Name: author.Name}
+			if author.Email != "" {
+				ja.URL = "mailto:" + author.Email
+			}
+			ji.Authors = append(ji.Authors, ja)
+		}
+		j.Items = append(j.Items, ji)
+	}
+	data, err := json.MarshalIndent(j, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,193 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func feedsTestInput(siteinfo string) fstest.MapFS {
+	return fstest.MapFS{
+		"siteinfo.json":            {Data: []byte(siteinfo)},
+		"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+		"pages/index.en.md":        {Data: []byte("---\nauthor: A\ndate: 2018-01-01\n---\n# Hello\nworld")},
+		"pages/blog/catinfo.json":  {Data: []byte(`{"name": "Blog"}`)},
+		"pages/blog/post.en.md":    {Data: []byte("---\nauthor: A\ndate: 2018-01-02\ntags: t\n---\n# Post\nsee [home](/index.html)")},
+		"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ .Siteinfo.FeedLinksHelper .Page .Locale }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml": {Data: []byte("en:\n    categories:\n        page_list_name: \"Category: {{$1}}\"\n")},
+	}
+}
+
+func TestGenerateFeeds(t *testing.T) {
+	input := feedsTestInput(`{"baseURL": "https://example.com/site/", "feeds": {"fullContent": true}, "locales": {"en": {"path": "/", "title": "Test"}}, "authors": [{"name": "A", "email": "a@example.com"}]}`)
+	out := NewMapOutput()
+	res, err := Build(context.Background(), Options{FS: input, Output: out})
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	if res.Feeds != 12 {
+		t.Errorf("got %v feeds; want 12", res.Feeds)
+	}
+	files := out.Files()
+
+	var rss struct {
+		Channel struct {
+			// the atom:link of the channel is decoded too
+			Links []string `xml:"link"`
+			Items []struct {
+				Link        string `xml:"link"`
+				Author      string `xml:"author"`
+				Description string `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(files["blog/feed.xml"], &rss); err != nil {
+		t.Fatalf("blog/feed.xml: got err = %v; want nil", err)
+	}
+	if got, want := rss.Channel.Links[0], "https://example.com/site/blog/index.html"; got != want {
+		t.Errorf("got channel link %q; want %q", got, want)
+	}
+	if len(rss.Channel.Items) != 1 {
+		t.Fatalf("got %v items; want 1", len(rss.Channel.Items))
+	}
+	if got, want := rss.Channel.Items[0].Link, "https://example.com/site/blog/post.html"; got != want {
+		t.Errorf("got item link %q; want %q", got, want)
+	}
+	if got, want := rss.Channel.Items[0].Author, "a@example.com (A)"; got != want {
+		t.Errorf("got item author %q; want %q", got, want)
+	}
+	if !strings.Contains(rss.Channel.Items[0].Description, `href="https://example.com/site/index.html"`) {
+		t.Errorf("got item description %q; want an absolute link", rss.Channel.Items[0].Description)
+	}
+
+	var atom struct {
+		ID      string `xml:"id"`
+		Entries []struct {
+			ID string `xml:"id"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(files["atom.xml"], &atom); err != nil {
+		t.Fatalf("atom.xml: got err = %v; want nil", err)
+	}
+	if got, want := atom.ID, "https://example.com/site/atom.xml"; got != want {
+		t.Errorf("got atom id %q; want %q", got, want)
+	}
+	if len(atom.Entries) != 2 {
+		t.Errorf("got %v atom entries; want 2", len(atom.Entries))
+	}
+
+	var jsonFeed struct {
+		FeedURL string `json:"feed_url"`
+		Items   []struct {
+			Tags []string `json:"tags"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(files["tag/t/feed.json"], &jsonFeed); err != nil {
+		t.Fatalf("tag/t/feed.json: got err = %v; want nil", err)
+	}
+	if got, want := jsonFeed.FeedURL, "https://example.com/site/tag/t/feed.json"; got != want {
+		t.Errorf("got feed_url %q; want %q", got, want)
+	}
+	if len(jsonFeed.Items) != 1 || !reflect.DeepEqual(jsonFeed.Items[0].Tags, []string{"t"}) {
+		t.Errorf("got items %v; want one tagged t", jsonFeed.Items)
+	}
+
+	links := string(files["blog/post.html"])
+	for _, href := range []string{"https://example.com/site/feed.xml", "https://example.com/site/blog/atom.xml"} {
+		if !strings.Contains(links, `href="`+href+`"`) {
+			t.Errorf("got links %q; want one to %v", links, href)
+		}
+	}
+}
+
+func TestGenerateFeeds_unpublished(t *testing.T) {
+	input := feedsTestInput(`{"baseURL": "https://example.com", "fallback": true, "locales": {"en": {"path": "/"}, "fr": {"path": "/fr"}}, "authors": [{"name": "A"}]}`)
+	input["pages/blog/draft.en.md"] = &fstest.MapFile{Data: []byte("---\nauthor: A\ndate: 2018-01-03\ntags: d\ndraft: true\n---\n# Draft")}
+	input["templates/locales/fr.yml"] = &fstest.MapFile{Data: []byte("fr:\n    locale_name: Français\n")}
+	out := NewMapOutput()
+	if _, err := Build(context.Background(), Options{FS: input, Output: out, Drafts: true}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	files := out.Files()
+
+	// tags, authors and archives holding only drafts or untranslated pages list them, but have no feeds
+	testCases := []struct {
+		dir      string
+		wantFeed bool
+	}{
+		{"tag/t", true},
+		{"tag/d", false},
+		{"fr/tag/t", false},
+		{"fr/author/a", false},
+		{"fr/blog", false},
+		{"fr/archive/2018", false},
+		{"fr", true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if _, ok := files[path.Join(tc.dir, "index.html")]; !ok {
+				t.Errorf("got no %v/index.html; want the pages listed", tc.dir)
+			}
+			for _, name := range []string{"feed.xml", "atom.xml", "feed.json"} {
+				if _, ok := files[path.Join(tc.dir, name)]; ok != tc.wantFeed {
+					t.Errorf("got %v/%v generated = %v; want %v", tc.dir, name, ok, tc.wantFeed)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateFeeds_config(t *testing.T) {
+	testCases := []struct {
+		siteinfo string
+		files    []string
+	}{
+		{`{"locales": {"en": {"path": "/", "title": "Test"}}, "authors": [{"name": "A"}]}`, nil},
+		{`{"baseURL": "https://example.com", "feeds": {"formats": ["atom"]}, "locales": {"en": {"path": "/", "title": "Test"}}, "authors": [{"name": "A"}]}`, []string{"atom.xml", "author/a/atom.xml", "blog/atom.xml", "tag/t/atom.xml"}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			out := NewMapOutput()
+			if _, err := Build(context.Background(), Options{FS: feedsTestInput(tc.siteinfo), Output: out}); err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			var files []string
+			for _, name := range out.Names() {
+				if base := path.Base(name); base == "feed.xml" || base == "atom.xml" || base == "feed.json" {
+					files = append(files, name)
+				}
+			}
+			if !reflect.DeepEqual(files, tc.files) {
+				t.Errorf("got feeds %v; want %v", files, tc.files)
+			}
+		})
+	}
+}
+
+func TestFeedConfig_check(t *testing.T) {
+	testCases := []struct {
+		fc    FeedConfig
+		isErr bool
+	}{
+		{FeedConfig{}, false},
+		{FeedConfig{Formats: []string{FeedRSS, FeedJSON}}, false},
+		{FeedConfig{Formats: []string{"rdf"}}, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if err := tc.fc.check(); (err != nil) != tc.isErr {
+				t.Errorf("got err = %v; want error: %v", err, tc.isErr)
+			}
+		})
+	}
+}
@@ -2,11 +2,13 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
-	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 )
 
 // FileExists returns whether a given name exists and is a regular file.
@@ -45,34 +47,75 @@ func ReadFile(name string) ([]byte, error) {
 	return content, nil
 }
 
-// WalkDir walks a directory tree beginning at the given root.
+// WalkDir walks a directory tree of fsys beginning at the given root.
 // In every directory, it first calls the callback on every regular file.
 // Then it pushes all subdirectories to the queue.
-func WalkDir(root string, callback func(fname string) error) error {
+func WalkDir(fsys fs.FS, root string, callback func(fname string) error) error {
 	for dirQueue := []string{root}; len(dirQueue) > 0; dirQueue = dirQueue[1:] {
-		dir, err := os.Open(dirQueue[0])
+		entries, err := fs.ReadDir(fsys, dirQueue[0])
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
 			return err
 		}
 
-		names, err := dir.Readdirnames(0)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return err
-		}
-
-		for _, name := range names {
-			if FileExists(dirQueue[0] + "/" + name) {
-				err = callback(dirQueue[0] + "/" + name)
+		for _, entry := range entries {
+			name := path.Join(dirQueue[0], entry.Name())
+			fi, err := fs.Stat(fsys, name)
+			if err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() {
+				err = callback(name)
 				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
 					return err
 				}
-			} else if DirectoryExists(dirQueue[0] + "/" + name) {
-				dirQueue = append(dirQueue, dirQueue[0]+"/"+name)
+			} else if fi.IsDir() {
+				dirQueue = append(dirQueue, name)
 			}
 		}
 	}
 	return nil
 }
+
+// dirExistsFS returns whether a given name exists in fsys and is a directory.
+func dirExistsFS(fsys fs.FS, name string) bool {
+	fi, err := fs.Stat(fsys, name)
+	return err == nil && fi.IsDir()
+}
+
+// CopyDir copies all the regular files under the directory dir of fsys to out, keeping their paths.
+// It returns the number of copied files.
+func CopyDir(fsys fs.FS, dir string, out Output) (n int, err error) {
+	return copyDir(fsys, dir, out, nil)
+}
+
+// copyDir is CopyDir, reusing the files of the previous build that did not change according to cache.
+// Reused files are not counted.
+func copyDir(fsys fs.FS, dir string, out Output, cache *buildCache) (n int, err error) {
+	err = WalkDir(fsys, dir, func(fpath string) error {
+		key, err := cache.fileKey(fsys, fpath)
+		if err != nil {
+			return err
+		}
+		if kept, err := cache.keep(fpath, key); kept || err != nil {
+			return err
+		}
+
+		src, err := fsys.Open(fpath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := out.Create(fpath)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		n++
+		return dst.Close()
+	})
+	return n, err
+}
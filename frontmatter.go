@@ -0,0 +1,350 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Front matter formats.
+const (
+	FrontMatterNone   = ""
+	FrontMatterYAML   = "yaml"
+	FrontMatterTOML   = "toml"
+	FrontMatterLegacy = "legacy"
+)
+
+// FrontMatter holds the meta-data given at the beginning of the source file of a page.
+// It is either YAML between `---` lines, TOML between `+++` lines, or legacy `#!` directives:
+//
+//	---
+//	title: Hello
+//	author: Jane Doe
+//	date: 2018-06-02
+//	updated: 2018-06-05 14:30
+//	expires: 2019-01-01
+//	tags: [blog, golang]
+//	---
+//
+// Authors and tags can be lists or comma-separated strings, and `authors` is a synonym for `author`.
+// Date, Updated and Expires are kept as written, with an optional time of day and timezone, see dateLayouts.
+// Other keys are kept in Params, with nested tables as maps of strings.
+// Format is the format the front matter was written in.
+type FrontMatter struct {
+	Format        string
+	Title         string
+	Authors       []string
+	Date          string
+	Updated       string
+	Expires       string
+	Tags          []string
+	ShortSummary  string
+	Draft         bool
+	Unlisted      bool
+	FeaturedImage string
+	Params        map[string]interface{}
+}
+
+// ParseFrontMatter splits the source of a page into its front matter and its markdown content.
+// Legacy `#!` directives are only read from the lines at the very beginning of the file, before any other line,
+// so that they cannot be mistaken for content.
+func ParseFrontMatter(src []byte) (FrontMatter, []byte, error) {
+	src = bytes.TrimPrefix(src, []byte("\ufeff"))
+	for _, f := range []struct{ format, delim string }{{FrontMatterYAML, "---"}, {FrontMatterTOML, "+++"}} {
+		header, content, ok := splitFrontMatter(src, f.delim)
+		if !ok {
+			continue
+		}
+
+		format := f.format
+		var m map[string]interface{}
+		var err error
+		if format == FrontMatterYAML {
+			err = yaml.Unmarshal(header, &m)
+		} else {
+			m, err = parseTOML(header)
+		}
+		if err != nil {
+			return FrontMatter{}, nil, fmt.Errorf("invalid %v front matter: %v", format, err)
+		}
+		fm, err := frontMatterFromMap(m)
+		fm.Format = format
+		return fm, content, err
+	}
+	return parseLegacyFrontMatter(src)
+}
+
+// splitFrontMatter returns the front matter between the delim lines at the beginning of src, and the content after it.
+func splitFrontMatter(src []byte, delim string) (header, content []byte, ok bool) {
+	firstLine, rest := cutLine(src)
+	if strings.TrimSpace(string(firstLine)) != delim {
+		return nil, nil, false
+	}
+	for start := len(src) - len(rest); len(rest) > 0; {
+		var line []byte
+		line, rest = cutLine(rest)
+		if strings.TrimSpace(string(line)) == delim {
+			return src[start : len(src)-len(rest)-len(line)], rest, true
+		}
+	}
+	return nil, nil, false
+}
+
+// cutLine returns the first line of b, including its line ending, and the following lines.
+func cutLine(b []byte) (line, rest []byte) {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i+1], b[i+1:]
+	}
+	return b, nil
+}
+
+// parseLegacyFrontMatter reads `#!` directives from the first lines of src.
+// Unknown directives are kept in Params.
+func parseLegacyFrontMatter(src []byte) (FrontMatter, []byte, error) {
+	fm := FrontMatter{}
+	content := src
+	for len(content) > 0 {
+		line, rest := cutLine(content)
+		directive := strings.TrimSpace(string(line))
+		if directive != "" && !strings.HasPrefix(directive, "#!") {
+			break
+		}
+		content = rest
+		if directive == "" {
+			continue
+		}
+
+		fm.Format = FrontMatterLegacy
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(directive, "#!"), ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		switch name {
+		case "author":
+			fm.Authors = splitList(value)
+		case "date":
+			fm.Date = value
+		case "updated":
+			fm.Updated = value
+		case "expires":
+			fm.Expires = value
+		case "tags":
+			fm.Tags = splitList(value)
+		case "short-summary":
+			fm.ShortSummary = value
+		case "draft":
+			fm.Draft = true
+		case "unlisted":
+			fm.Unlisted = true
+		default:
+			// unknown directives are kept like unknown YAML keys, and a directive without a value is a flag
+			if fm.Params == nil {
+				fm.Params = make(map[string]interface{})
+			}
+			if hasValue {
+				fm.Params[name] = value
+			} else {
+				fm.Params[name] = true
+			}
+		}
+	}
+
+	if fm.Format == FrontMatterNone {
+		return fm, src, nil
+	}
+	return fm, content, nil
+}
+
+// frontMatterFromMap reads the known keys of decoded YAML or TOML front matter.
+func frontMatterFromMap(m map[string]interface{}) (fm FrontMatter, err error) {
+	for key, value := range m {
+		switch key {
+		case "title":
+			fm.Title, err = frontMatterString(key, value)
+		case "author", "authors":
+			fm.Authors, err = frontMatterList(key, value)
+		case "date":
+			fm.Date, err = frontMatterString(key, value)
+		case "updated":
+			fm.Updated, err = frontMatterString(key, value)
+		case "expires":
+			fm.Expires, err = frontMatterString(key, value)
+		case "tags":
+			fm.Tags, err = frontMatterList(key, value)
+		case "short-summary":
+			fm.ShortSummary, err = frontMatterString(key, value)
+		case "draft":
+			fm.Draft, err = frontMatterBool(key, value)
+		case "unlisted":
+			fm.Unlisted, err = frontMatterBool(key, value)
+		case "featured-image":
+			fm.FeaturedImage, err = frontMatterString(key, value)
+		default:
+			if fm.Params == nil {
+				fm.Params = make(map[string]interface{})
+			}
+			fm.Params[key] = normalizeParam(value)
+		}
+		if err != nil {
+			return fm, err
+		}
+	}
+	return fm, nil
+}
+
+// normalizeParam converts the maps decoded from YAML, whose keys may be of any type, to maps of strings,
+// so that params are all of the same types whatever their format.
+func normalizeParam(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalizeParam(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = normalizeParam(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = normalizeParam(value)
+		}
+		return l
+	}
+	return value
+}
+
+// frontMatterString converts a scalar value of the front matter to a string.
+func frontMatterString(key string, value interface{}) (string, error) {
+	switch value.(type) {
+	case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+		return "", fmt.Errorf("%v: got a list or a table, want a single value", key)
+	case nil:
+		return "", nil
+	case time.Time:
+		return value.(time.Time).Format(time.RFC3339), nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// frontMatterBool converts a boolean value of the front matter.
+func frontMatterBool(key string, value interface{}) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v: got %v, want true or false", key, value)
+	}
+	return b, nil
+}
+
+// frontMatterList converts a list or a comma-separated string of the front matter to a slice.
+func frontMatterList(key string, value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		s, err := frontMatterString(key, value)
+		return splitList(s), err
+	}
+	var values []string
+	for _, v := range list {
+		s, err := frontMatterString(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// yamlFrontMatter is the YAML encoding of the front matter.
+type yamlFrontMatter struct {
+	Title         string                 `yaml:"title,omitempty"`
+	Author        string                 `yaml:"author,omitempty"`
+	Authors       []string               `yaml:"authors,omitempty,flow"`
+	Date          string                 `yaml:"date,omitempty"`
+	Updated       string                 `yaml:"updated,omitempty"`
+	Expires       string                 `yaml:"expires,omitempty"`
+	Tags          []string               `yaml:"tags,omitempty,flow"`
+	ShortSummary  string                 `yaml:"short-summary,omitempty"`
+	Draft         bool                   `yaml:"draft,omitempty"`
+	Unlisted      bool                   `yaml:"unlisted,omitempty"`
+	FeaturedImage string                 `yaml:"featured-image,omitempty"`
+	Params        map[string]interface{} `yaml:",inline"`
+}
+
+// YAML returns the front matter as YAML between `---` lines.
+func (fm FrontMatter) YAML() ([]byte, error) {
+	y := yamlFrontMatter{
+		Title:         fm.Title,
+		Date:          fm.Date,
+		Updated:       fm.Updated,
+		Expires:       fm.Expires,
+		Tags:          fm.Tags,
+		ShortSummary:  fm.ShortSummary,
+		Draft:         fm.Draft,
+		Unlisted:      fm.Unlisted,
+		FeaturedImage: fm.FeaturedImage,
+		Params:        fm.Params,
+	}
+	if len(fm.Authors) == 1 {
+		y.Author = fm.Authors[0]
+	} else {
+		y.Authors = fm.Authors
+	}
+	data, err := yaml.Marshal(y)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte("---\n"), data...), "---\n"...), nil
+}
+
+var (
+	titleRE         = regexp.MustCompile(`^# +(.+?)[ #]*$`)
+	codeFenceOpenRE = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+)
+
+// firstHeading returns the text of the first level 1 heading of a markdown content, outside of code blocks,
+// or "" if there is none.
+func firstHeading(content []byte) string {
+	fence := ""
+	for len(content) > 0 {
+		var line []byte
+		line, content = cutLine(content)
+		l := strings.TrimRight(string(line), "\r\n")
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(l), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := codeFenceOpenRE.FindStringSubmatch(l); m != nil {
+			fence = m[1]
+			continue
+		}
+		if m := titleRE.FindStringSubmatch(l); m != nil {
+			return strings.TrimSpace(m[1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	testCases := []struct {
+		src     string
+		want    FrontMatter
+		content string
+		err     bool
+	}{
+		{"# Title\ncontent", FrontMatter{}, "# Title\ncontent", false},
+		{
+			"---\ntitle: Hello\nauthor: A, B\ndate: 2018-06-02\ntags: [blog, golang]\ndraft: true\n---\n# Hello\n",
+			FrontMatter{Format: FrontMatterYAML, Title: "Hello", Authors: []string{"A", "B"}, Date: "2018-06-02", Tags: []string{"blog", "golang"}, Draft: true},
+			"# Hello\n", false,
+		},
+		{
+			"---\nauthors:\n  - A\ntags: blog\nshort-summary: 42\n---\n",
+			FrontMatter{Format: FrontMatterYAML, Authors: []string{"A"}, Tags: []string{"blog"}, ShortSummary: "42"},
+			"", false,
+		},
+		{
+			"+++\ntitle = \"Hello\"\nauthor = \"A\"\ndate = 2018-06-02\ntags = [\"blog\"]\n+++\ncontent",
+			FrontMatter{Format: FrontMatterTOML, Title: "Hello", Authors: []string{"A"}, Date: "2018-06-02", Tags: []string{"blog"}},
+			"content", false,
+		},
+		{
+			"+++\ndate = 2018-06-02T10:00:00+02:00\nupdated = 2018-06-05\n+++\n",
+			FrontMatter{Format: FrontMatterTOML, Date: "2018-06-02T10:00:00+02:00", Updated: "2018-06-05"},
+			"", false,
+		},
+		{
+			"---\ndate: 2018-06-02 10:00\nupdated: 2018-06-05T08:00:00Z\nexpires: 2019-01-01\n---\n",
+			FrontMatter{Format: FrontMatterYAML, Date: "2018-06-02 10:00", Updated: "2018-06-05T08:00:00Z", Expires: "2019-01-01"},
+			"", false,
+		},
+		{
+			"#!author: A, B\n#!date: 2018-06-02\n#!tags: blog, golang\n#!short-summary: Hi\n#!draft\n\n# Title\n",
+			FrontMatter{Format: FrontMatterLegacy, Authors: []string{"A", "B"}, Date: "2018-06-02", Tags: []string{"blog", "golang"}, ShortSummary: "Hi", Draft: true},
+			"# Title\n", false,
+		},
+		{"#!date: 2018-06-02\n#!updated: 2018-06-05 14:30\n#!expires: 2019-01-01\n", FrontMatter{Format: FrontMatterLegacy, Date: "2018-06-02", Updated: "2018-06-05 14:30", Expires: "2019-01-01"}, "", false},
+		{"#!date: 2018-06-02\n\n```\n#!draft\n```\n", FrontMatter{Format: FrontMatterLegacy, Date: "2018-06-02"}, "```\n#!draft\n```\n", false},
+		{"#!author: A\n# Title\n#!draft\n", FrontMatter{Format: FrontMatterLegacy, Authors: []string{"A"}}, "# Title\n#!draft\n", false},
+		{
+			"---\ntitle: T\nsubtitle: S\nhero:\n  caption: C\n  sizes: [1, 2]\n---\n",
+			FrontMatter{Format: FrontMatterYAML, Title: "T", Params: map[string]interface{}{"subtitle": "S", "hero": map[string]interface{}{"caption": "C", "sizes": []interface{}{1, 2}}}},
+			"", false,
+		},
+		{
+			"+++\nhide-sidebar = true\n[hero]\ncaption = \"C\"\n+++\n",
+			FrontMatter{Format: FrontMatterTOML, Params: map[string]interface{}{"hide-sidebar": true, "hero": map[string]interface{}{"caption": "C"}}},
+			"", false,
+		},
+		{"---\nunlisted: true\n---\n", FrontMatter{Format: FrontMatterYAML, Unlisted: true}, "", false},
+		{"+++\nunlisted = false\n+++\n", FrontMatter{Format: FrontMatterTOML}, "", false},
+		{"#!unlisted\n# Legal notice\n", FrontMatter{Format: FrontMatterLegacy, Unlisted: true}, "# Legal notice\n", false},
+		{"#!color: red\n#!publish\n# Title\n", FrontMatter{Format: FrontMatterLegacy, Params: map[string]interface{}{"color": "red", "publish": true}}, "# Title\n", false},
+		{"---\ntitle: [\n---\n", FrontMatter{}, "", true},
+		{"---\ndraft: maybe\n---\n", FrontMatter{}, "", true},
+		{"---\nunlisted: 1\n---\n", FrontMatter{}, "", true},
+		{"+++\ntitle = \n+++\n", FrontMatter{}, "", true},
+		{"---\nno end", FrontMatter{}, "---\nno end", false},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			fm, content, err := ParseFrontMatter([]byte(tc.src))
+			if (err != nil) != tc.err {
+				t.Fatalf("got err = %v; want error: %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(fm, tc.want) {
+				t.Errorf("got %+v; want %+v", fm, tc.want)
+			}
+			if string(content) != tc.content {
+				t.Errorf("got content %q; want %q", content, tc.content)
+			}
+		})
+	}
+}
+
+func TestFrontMatter_YAML(t *testing.T) {
+	testCases := []FrontMatter{
+		{Format: FrontMatterYAML, Authors: []string{"A"}, Date: "2018-06-02", Tags: []string{"blog", "golang"}},
+		{Format: FrontMatterYAML, Date: "2018-06-02 10:00", Updated: "2018-06-05", Expires: "2019-01-01"},
+		{Format: FrontMatterYAML, Title: "Title: with colon", Authors: []string{"A", "B"}, ShortSummary: "Hi", Draft: true},
+		{Format: FrontMatterYAML, Title: "Legal notice", Unlisted: true},
+		{Format: FrontMatterYAML, Params: map[string]interface{}{"subtitle": "S", "hero": map[string]interface{}{"caption": "C"}}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			data, err := tc.YAML()
+			if err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			got, _, err := ParseFrontMatter(data)
+			if err != nil || !reflect.DeepEqual(got, tc) {
+				t.Errorf("got %+v, %v; want %+v, nil from:\n%s", got, err, tc, data)
+			}
+		})
+	}
+}
+
+func TestFirstHeading(t *testing.T) {
+	testCases := []struct {
+		content string
+		want    string
+	}{
+		{"# Title\ncontent", "Title"},
+		{"intro\n\n#  Title #\n", "Title"},
+		{"## Sub\n# Title", "Title"},
+		{"```\n# comment\n```\n# Title", "Title"},
+		{"~~~~\n# comment\n~~~\n~~~~\n# Title", "Title"},
+		{"#hashtag\n", ""},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := firstHeading([]byte(tc.content)); got != tc.want {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,83 +2,124 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
-	"os"
+	"bytes"
+	"context"
+	"fmt"
 	"path"
+	"sync"
 	"text/template"
-
-	"github.com/qor/i18n"
 )
 
-// GenerateIndividualPages creates HTML files and calls the templates for each page defined in the website
-func GenerateIndividualPages(siteinfo *Siteinfo, tree *Category, templates *template.Template, inputDir, outputDir string, locales *i18n.I18n, locale string) (n int, err error) {
-	for catQueue := []*Category{tree}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
-		// skip empty category
-		tagCat, err := tree.TagCategory()
-		if err != nil {
-			return n, err
-		}
-		if catQueue[0].PageCount(locale) == 0 && !catQueue[0].IsUnder(tagCat) {
-			continue
-		}
+// GenerateIndividualPages creates HTML files and calls the templates for each page defined in the website.
+// Pages are rendered by up to jobs goroutines at once; the generated files do not depend on it.
+func GenerateIndividualPages(ctx context.Context, siteinfo *Siteinfo, tree *Category, templates *template.Template, out Output, locale string, jobs int) (n int, err error) {
+	return generatePages(ctx, siteinfo, tree, templates, out, locale, jobs, nil)
+}
+
+// generatePages is GenerateIndividualPages, reusing the pages of the previous build that did not change according to cache.
+func generatePages(ctx context.Context, siteinfo *Siteinfo, tree *Category, templates *template.Template, out Output, locale string, jobs int, cache *buildCache) (n int, err error) {
+	pages := individualPages(tree, locale)
+	if jobs < 1 {
+		jobs = 1
+	}
 
-		// create subdirectories
-		for _, subCat := range catQueue[0].SubCategories {
-			if !DirectoryExists(path.Join(outputDir, siteinfo.Locales[locale].Path, subCat.Path(locale))) {
-				err = os.Mkdir(path.Join(outputDir, siteinfo.Locales[locale].Path, subCat.Path(locale)), 0755)
-				if err != nil {
-					return n, err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make([]error, len(pages))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if errs[i] = generatePage(siteinfo, tree, templates, out, locale, pages[i], cache); errs[i] != nil {
+					cancel()
 				}
 			}
+		}()
+	}
+feed:
+	for i := range pages {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break feed
 		}
+	}
+	close(queue)
+	wg.Wait()
+
+	// report the error of the first page in order, so that it does not depend on scheduling
+	for i := range pages {
+		if errs[i] != nil {
+			return 0, errs[i]
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return len(pages), nil
+}
 
-		// create page files
+// individualPages lists the pages to generate for a locale, each under the category it is accessed by.
+func individualPages(tree *Category, locale string) []*Page {
+	var pages []*Page
+	for catQueue := []*Category{tree}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
+		// empty categories have no index pages, but may hold unlisted pages
 		for _, page := range catQueue[0].Locales[locale].Pages {
 			// skip page if its category is not the one it’s accessed by
-			if catQueue[0] != page.Category {
-				continue
-			}
-
-			// create file
-			pageFile, err := os.OpenFile(path.Join(outputDir, siteinfo.Locales[locale].Path, page.Path()), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
-			if err != nil {
-				return n, err
+			if catQueue[0] == page.Category {
+				pages = append(pages, page)
 			}
+		}
+	}
+	return pages
+}
 
-			// prepare template argument
-			arg := map[string]interface{}{
-				"Siteinfo": *siteinfo,
-				"Locale":   locale,
-				"Page":     page,
-				"Tree":     tree,
-			}
+// generatePage renders a page and writes it to out, unless cache keeps it from the previous build.
+// The content of the page is parsed as a template in a copy of templates, leaving them untouched.
+func generatePage(siteinfo *Siteinfo, tree *Category, templates *template.Template, out Output, locale string, page *Page, cache *buildCache) error {
+	localePath := siteinfo.Locales[locale].Path
+	name := path.Join(localePath, page.Path())
+	if kept, err := cache.keep(name, cache.pageKey(page, locale)); kept || err != nil {
+		return err
+	}
 
-			// header template
-			err = templates.ExecuteTemplate(pageFile, "Header", arg)
-			if err != nil {
-				return n, err
-			}
+	data, err := renderPage(siteinfo, tree, templates, locale, page, page.ContentHelper(localePath), "Header", "Content", "Footer")
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	return writeFile(out, name, data)
+}
 
-			// content template
-			templates = template.Must(templates.Parse("{{ define \"Content\" }}{{ $localePath := (index .Siteinfo.Locales .Locale).Path }}" + page.ContentHelper(siteinfo.Locales[locale].Path) + "{{ end }}"))
-			err = templates.ExecuteTemplate(pageFile, "Content", arg)
-			if err != nil {
-				return n, err
-			}
-			template.Must(templates.Parse("{{ define \"Content\" }}{{ end }}"))
+// renderPage executes the named templates for a page, content being the html used as the "Content" template.
+func renderPage(siteinfo *Siteinfo, tree *Category, templates *template.Template, locale string, page *Page, content string, parts ...string) ([]byte, error) {
+	tmpl, err := templates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmpl.Parse("{{ define \"Content\" }}{{ $localePath := (index .Siteinfo.Locales .Locale).Path }}" + content + "{{ end }}")
+	if err != nil {
+		return nil, err
+	}
 
-			// footer template
-			err = templates.ExecuteTemplate(pageFile, "Footer", arg)
-			if err != nil {
-				return n, err
-			}
+	// prepare template argument
+	arg := map[string]interface{}{
+		"Siteinfo": *siteinfo,
+		"Locale":   locale,
+		"Page":     page,
+		"Tree":     tree,
+	}
 
-			// generated page count
-			n++
+	var buf bytes.Buffer
+	for _, part := range parts {
+		if err := tmpl.ExecuteTemplate(&buf, part, arg); err != nil {
+			return nil, err
 		}
 	}
-
-	return n, nil
+	return buf.Bytes(), nil
 }
@@ -2,24 +2,92 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"path"
+	"strings"
 
 	"github.com/qor/i18n"
-	"github.com/qor/i18n/backends/yaml"
+	"gopkg.in/yaml.v2"
 )
 
-// LoadLocales loads
-func LoadLocales(localesDir string) *i18n.I18n {
-	paths, err := filepath.Glob(filepath.Join(localesDir, "*.yml"))
+// LoadLocales loads the yml locale files of the templates found in the directory localesDir of fsys,
+// except the stubs files written by `tomato i18n status --write-stubs`.
+func LoadLocales(fsys fs.FS, localesDir string) (*i18n.I18n, error) {
+	paths, err := fs.Glob(fsys, path.Join(localesDir, "*.yml"))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error: bad pattern in localesDir")
-		os.Exit(1)
+		return nil, fmt.Errorf("bad pattern in localesDir")
 	}
 
-	return i18n.New(yaml.New(paths...))
+	backend := &localesBackend{}
+	for _, fpath := range paths {
+		if isStubsLocaleFile(fpath) {
+			continue
+		}
+		translations, err := readLocaleFile(fsys, fpath)
+		if err != nil {
+			return nil, err
+		}
+		backend.translations = append(backend.translations, translations...)
+	}
+
+	return i18n.New(backend), nil
+}
+
+// isStubsLocaleFile tells whether a locale file holds the stubs of missing strings, see StubsLocaleFile.
+func isStubsLocaleFile(fpath string) bool {
+	return strings.HasSuffix(fpath, ".stubs.yml")
+}
+
+// readLocaleFile reads the translations of a yml locale file, whose top-level keys are locales.
+func readLocaleFile(fsys fs.FS, fpath string) (translations []*i18n.Translation, err error) {
+	content, err := fs.ReadFile(fsys, fpath)
+	if err != nil {
+		return nil, err
+	}
+	var slice yaml.MapSlice
+	if err := yaml.Unmarshal(content, &slice); err != nil {
+		return nil, fmt.Errorf("%v: %v", fpath, err)
+	}
+	for _, item := range slice {
+		translations = append(translations, yamlTranslations(fmt.Sprint(item.Key), item.Value, nil)...)
+	}
+	return translations, nil
+}
+
+// yamlTranslations flattens a yml tree into translations whose keys are joined with dots, like `full_page.header.page`.
+func yamlTranslations(locale string, value interface{}, scopes []string) (translations []*i18n.Translation) {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			translations = append(translations, yamlTranslations(locale, item.Value, append(scopes, fmt.Sprint(item.Key)))...)
+		}
+	default:
+		translations = append(translations, &i18n.Translation{Locale: locale, Key: strings.Join(scopes, "."), Value: fmt.Sprint(v)})
+	}
+	return
+}
+
+// localesBackend is a read-only i18n backend holding translations loaded beforehand.
+type localesBackend struct {
+	translations []*i18n.Translation
+}
+
+// LoadTranslations returns the loaded translations.
+func (b *localesBackend) LoadTranslations() []*i18n.Translation {
+	return b.translations
+}
+
+// SaveTranslation fails: locale files are never written.
+func (b *localesBackend) SaveTranslation(t *i18n.Translation) error {
+	return errors.New("not implemented")
+}
+
+// DeleteTranslation fails: locale files are never written.
+func (b *localesBackend) DeleteTranslation(t *i18n.Translation) error {
+	return errors.New("not implemented")
 }
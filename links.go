@@ -0,0 +1,235 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// BrokenLink is a link of a generated html file whose target is not in the website.
+// File is the html file, Source the markdown file of its page, empty for the pages generated by tomato.
+// Reason tells what is missing, the file or the anchor of the fragment.
+type BrokenLink struct {
+	File   string `json:"file"`
+	Source string `json:"source,omitempty"`
+	Link   string `json:"link"`
+	Reason string `json:"reason"`
+}
+
+// LinkReport is the result of CheckLinks.
+// Broken is sorted by file, UnusedMedia lists the files of `media/` that nothing links to.
+type LinkReport struct {
+	Broken      []BrokenLink `json:"broken"`
+	UnusedMedia []string     `json:"unusedMedia"`
+}
+
+// linkedFile is what CheckLinks reads of a generated file: the anchors it defines and the links it holds.
+type linkedFile struct {
+	ids   map[string]bool
+	links []string
+}
+
+// linkAttributes are the attributes holding links, by element.
+var linkAttributes = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"img":    {"src", "srcset"},
+	"script": {"src"},
+	"iframe": {"src"},
+	"embed":  {"src"},
+	"source": {"src", "srcset"},
+	"track":  {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+}
+
+// cssURLRE matches the url() of stylesheets and style attributes.
+var cssURLRE = regexp.MustCompile(`url\(\s*['"]?([^'")]+?)['"]?\s*\)`)
+
+// CheckLinks reads the html files of the website generated from s in fsys, like os.DirFS of the output directory,
+// and reports their links to files or `#fragment` anchors that do not exist, along with the featured images of pages.
+// Links to other websites are not checked, except those starting with the base URL of a locale.
+// It also lists the files of the media directory that no html or css file links to.
+func (s *Site) CheckLinks(ctx context.Context, fsys fs.FS) (*LinkReport, error) {
+	// read every file of the website, parsing html and css ones
+	files := make(map[string]*linkedFile)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() == ManifestName {
+			return nil
+		}
+		file := &linkedFile{}
+		files[name] = file
+		switch path.Ext(name) {
+		case ".html", ".css":
+			content, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			if path.Ext(name) == ".css" {
+				file.links = cssURLs(string(content))
+				return nil
+			}
+			doc, err := html.Parse(bytes.NewReader(content))
+			if err != nil {
+				return err
+			}
+			file.ids = make(map[string]bool)
+			readLinks(doc, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// sources of the generated pages
+	sources := make(map[string]string)
+	for locale := range s.Siteinfo.Locales {
+		for _, page := range individualPages(s.Tree, locale) {
+			name := strings.TrimPrefix(path.Join(s.Siteinfo.Locales[locale].Path, page.Path()), "/")
+			sources[name] = page.Source
+			// featured images are relative to the root of the website, see the example templates
+			if file, ok := files[name]; ok && page.PathToFeaturedImage != "" {
+				link := page.PathToFeaturedImage
+				if !strings.Contains(link, "://") {
+					link = "/" + strings.TrimPrefix(link, "/")
+				}
+				file.links = append(file.links, link)
+			}
+		}
+	}
+
+	report := &LinkReport{}
+	used := make(map[string]bool)
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		seen := make(map[string]bool)
+		for _, link := range files[name].links {
+			target, fragment, ok := s.resolveLink(name, link)
+			if !ok || seen[target+"#"+fragment] {
+				continue
+			}
+			seen[target+"#"+fragment] = true
+			if _, exists := files[target]; !exists && files[path.Join(target, "index.html")] != nil {
+				target = path.Join(target, "index.html")
+			}
+			used[target] = true
+			reason := ""
+			if file, exists := files[target]; !exists {
+				reason = "no such file"
+			} else if fragment != "" && file.ids != nil && !file.ids[fragment] {
+				reason = "no such anchor #" + fragment
+			}
+			if reason != "" {
+				report.Broken = append(report.Broken, BrokenLink{File: name, Source: sources[name], Link: link, Reason: reason})
+			}
+		}
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, "media/") && !used[name] {
+			report.UnusedMedia = append(report.UnusedMedia, name)
+		}
+	}
+	return report, nil
+}
+
+// readLinks adds the anchors and the links of an html node and its children to file.
+func readLinks(n *html.Node, file *linkedFile) {
+	if n.Type == html.ElementNode {
+		attributes := linkAttributes[n.Data]
+		for _, attr := range n.Attr {
+			switch {
+			case attr.Key == "id", attr.Key == "name" && n.Data == "a":
+				file.ids[attr.Val] = true
+			case attr.Key == "style":
+				file.links = append(file.links, cssURLs(attr.Val)...)
+			case attr.Key == "srcset":
+				for _, candidate := range strings.Split(attr.Val, ",") {
+					if fields := strings.Fields(candidate); len(fields) > 0 {
+						file.links = append(file.links, fields[0])
+					}
+				}
+			default:
+				for _, key := range attributes {
+					if attr.Key == key {
+						file.links = append(file.links, attr.Val)
+					}
+				}
+			}
+		}
+		if n.Data == "style" && n.FirstChild != nil {
+			file.links = append(file.links, cssURLs(n.FirstChild.Data)...)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		readLinks(c, file)
+	}
+}
+
+// cssURLs returns the targets of the url() of some css.
+func cssURLs(css string) []string {
+	var links []string
+	for _, m := range cssURLRE.FindAllStringSubmatch(css, -1) {
+		links = append(links, m[1])
+	}
+	return links
+}
+
+// resolveLink returns the file of the website a link of the named file points to, and its fragment.
+// It returns false for links to other websites and links without a target, like `mailto:` ones.
+func (s *Site) resolveLink(name, link string) (target, fragment string, ok bool) {
+	link = strings.TrimSpace(link)
+	longest := ""
+	for locale := range s.Siteinfo.Locales {
+		if baseURL := s.Siteinfo.baseURL(locale); baseURL != "" && len(baseURL) > len(longest) && (link == baseURL || strings.HasPrefix(link, baseURL+"/")) {
+			longest = baseURL
+		}
+	}
+	if longest != "" {
+		link = "/" + strings.TrimPrefix(strings.TrimPrefix(link, longest), "/")
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return "", "", false
+	}
+	if u.Path == "" && u.Fragment == "" {
+		return "", "", false
+	}
+
+	target = u.Path
+	switch {
+	case target == "":
+		target = name
+	case strings.HasPrefix(target, "/"):
+		target = path.Clean(target)
+	default:
+		target = path.Join("/", path.Dir(name), target)
+	}
+	if strings.HasSuffix(u.Path, "/") || target == "/" {
+		target = path.Join(target, "index.html")
+	}
+	return strings.TrimPrefix(target, "/"), u.Fragment, true
+}
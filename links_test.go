@@ -0,0 +1,88 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSite_CheckLinks(t *testing.T) {
+	input := fstest.MapFS{
+		"siteinfo.json":               {Data: []byte(`{"baseURL": "https://example.com/blog", "locales": {"en": {"path": "/"}}}`)},
+		"pages/catinfo.json":          {Data: []byte(`{"name": "Home"}`)},
+		"pages/index.en.md":           {Data: []byte("# Home\n[ok](/projects/) [ok](projects/a.html#intro) [ok](https://example.com/blog/projects/a.html) [ok](https://golang.org/x) [ok](mailto:a@example.com)")},
+		"pages/projects/catinfo.json": {Data: []byte(`{"name": "Projects"}`)},
+		"pages/projects/a.en.md":      {Data: []byte("---\nfeatured-image: /media/missing.jpg\n---\n# A\n<h2 id=\"intro\">Intro</h2>\n[broken](a.html#outro) [broken](../nope.html) [broken](https://example.com/blog/gone.html) ![ok](/media/cat.jpg)")},
+		"templates/page.html":         {Data: []byte(`{{ define "Header" }}<link href="{{ .Page.PathToRoot "/" }}/assets/style.css">{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml":    {Data: []byte("en:\n    locale_name: English\n")},
+		"assets/style.css":            {Data: []byte("body { background: url('../media/bg.png'); }")},
+		"media/cat.jpg":               {Data: []byte("cat")},
+		"media/bg.png":                {Data: []byte("bg")},
+		"media/unused.png":            {Data: []byte("unused")},
+	}
+	s, err := LoadSite(context.Background(), Options{FS: input, Output: NewMapOutput()})
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	out := NewMapOutput()
+	if _, err := s.Generate(context.Background(), Options{FS: input, Output: out}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	output := fstest.MapFS{}
+	for name, data := range out.Files() {
+		output[name] = &fstest.MapFile{Data: data}
+	}
+
+	report, err := s.CheckLinks(context.Background(), output)
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	want := &LinkReport{
+		Broken: []BrokenLink{
+			{"projects/a.html", "pages/projects/a.en.md", "a.html#outro", "no such anchor #outro"},
+			{"projects/a.html", "pages/projects/a.en.md", "../nope.html", "no such file"},
+			{"projects/a.html", "pages/projects/a.en.md", "https://example.com/blog/gone.html", "no such file"},
+			{"projects/a.html", "pages/projects/a.en.md", "/media/missing.jpg", "no such file"},
+		},
+		UnusedMedia: []string{"media/unused.png"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("got %+v; want %+v", report, want)
+	}
+}
+
+func TestSite_resolveLink(t *testing.T) {
+	s := &Site{Siteinfo: Siteinfo{BaseURL: "https://example.com/", Locales: map[string]SiteinfoLocaleData{"en": {Path: "/"}, "fr": {Path: "/fr", BaseURL: "https://example.fr"}}}}
+	testCases := []struct {
+		name, link       string
+		target, fragment string
+		ok               bool
+	}{
+		{"blog/post.html", "other.html", "blog/other.html", "", true},
+		{"blog/post.html", "../media/a.jpg?v=2", "media/a.jpg", "", true},
+		{"blog/post.html", "/tag/", "tag/index.html", "", true},
+		{"blog/post.html", "#top", "blog/post.html", "top", true},
+		{"blog/post.html", "..", "index.html", "", true},
+		{"blog/post.html", "https://example.com/fr/a.html#b", "fr/a.html", "b", true},
+		{"blog/post.html", "https://example.fr/fr/a.html", "fr/a.html", "", true},
+		{"blog/post.html", "https://example.community/a.html", "", "", false},
+		{"blog/post.html", "//cdn.example.com/a.js", "", "", false},
+		{"blog/post.html", "mailto:a@example.com", "", "", false},
+		{"blog/post.html", "data:image/png;base64,AAAA", "", "", false},
+		{"blog/post.html", "", "", "", false},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			target, fragment, ok := s.resolveLink(tc.name, tc.link)
+			if target != tc.target || fragment != tc.fragment || ok != tc.ok {
+				t.Errorf("got %q, %q, %v; want %q, %q, %v", target, fragment, ok, tc.target, tc.fragment, tc.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"io"
+)
+
+// logger prints progress messages.
+// A nil out means quiet: nothing is printed.
+// Verbose messages are only printed if verbose is set,
+// and section titles are printed in ANSI bold only if bold is set.
+type logger struct {
+	out     io.Writer
+	verbose bool
+	bold    bool
+}
+
+// Section prints the title of a new step of the process.
+func (l *logger) Section(format string, args ...interface{}) {
+	if l == nil || l.out == nil {
+		return
+	}
+	if l.bold {
+		fmt.Fprintf(l.out, "\n\x1b[1m"+format+"\x1b[0m\n", args...)
+	} else {
+		fmt.Fprintf(l.out, "\n"+format+"\n", args...)
+	}
+}
+
+// Printf prints a progress message.
+func (l *logger) Printf(format string, args ...interface{}) {
+	if l == nil || l.out == nil {
+		return
+	}
+	fmt.Fprintf(l.out, format+"\n", args...)
+}
+
+// Verbosef prints a detailed progress message, only in verbose mode.
+func (l *logger) Verbosef(format string, args ...interface{}) {
+	if l == nil || !l.verbose {
+		return
+	}
+	l.Printf(format, args...)
+}
@@ -2,7 +2,7 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
 	"io"
@@ -16,9 +16,14 @@ const (
 
 // Html wraps the blackfriday markdown converter. It takes and returns a slice of bytes.
 func Html(content []byte, page *Page, localePath string) []byte {
+	return htmlWithPrefix(content, page.PathToRoot(localePath))
+}
+
+// htmlWithPrefix converts markdown to html, prepending prefix to links starting with a slash.
+func htmlWithPrefix(content []byte, prefix string) []byte {
 	renderer := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
-		AbsolutePrefix: page.PathToRoot(localePath),
-		Flags:          blackfriday.FootnoteReturnLinks,
+		AbsolutePrefix:             prefix,
+		Flags:                      blackfriday.FootnoteReturnLinks,
 		FootnoteReturnLinkContents: "<sup>&uarr;</sup>",
 	})
 	return blackfriday.Run(content, blackfriday.WithRenderer(renderer), blackfriday.WithExtensions(usedExtensions))
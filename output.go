@@ -0,0 +1,413 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output is where a website is written.
+// Names are slash-separated paths from the root of the website, like `fr/index.html`.
+// Create may be called from several goroutines at once.
+// If an output also has an `Abort() error` method, it is called instead of Close when a build fails.
+type Output interface {
+	// Create creates or truncates the named file, and its parent directories if needed.
+	Create(name string) (io.WriteCloser, error)
+	// Close finishes writing the website. No file can be created afterwards.
+	Close() error
+}
+
+// writeFile creates the named file in out with the given content.
+func writeFile(out Output, name string, data []byte) error {
+	f, err := out.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// aborter is implemented by outputs that can discard what was written when a build fails.
+type aborter interface {
+	Abort() error
+}
+
+// cleanName returns the canonical form of an output file name, without leading slash.
+func cleanName(name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", fmt.Errorf("invalid output file name %q", name)
+	}
+	return name, nil
+}
+
+// bufferedFile is an in-memory file that is handed to its output when closed.
+type bufferedFile struct {
+	bytes.Buffer
+	close func(content []byte) error
+}
+
+// Close hands the content of the file to its output.
+func (f *bufferedFile) Close() error {
+	return f.close(f.Bytes())
+}
+
+// ManifestName is the name of the file DirOutput writes at the root of every directory it creates.
+// It lists the files of the website, and marks the directory as safe to replace.
+const ManifestName = ".tomato-manifest"
+
+// manifestHeader is the first line of a manifest file.
+const manifestHeader = "# generated by tomato, this directory will be replaced by the next build"
+
+// DirOutput writes a website to a directory of the OS filesystem.
+// Files are written to a temporary directory next to it,
+// which replaces the directory only when the output is closed, that is when the build succeeded.
+// Files that did not change since the previous build are hard links to the previous ones.
+// A pre-existing directory is only replaced if it is empty or if it was created by tomato, holding a manifest.
+type DirOutput struct {
+	dir   string
+	tmp   string
+	mutex sync.Mutex
+	names map[string]bool
+}
+
+// NewDirOutput returns an output writing to dir.
+// It fails if dir exists and was not created by tomato.
+func NewDirOutput(dir string) (*DirOutput, error) {
+	dir = filepath.Clean(dir)
+	if err := checkReplaceable(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0775); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, 0775); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	return &DirOutput{dir: dir, tmp: tmp, names: make(map[string]bool)}, nil
+}
+
+// checkReplaceable returns an error if dir exists but is not an empty directory or a directory created by tomato.
+func checkReplaceable(dir string) error {
+	fi, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%v already exists and is not a directory", dir)
+	}
+	if FileExists(filepath.Join(dir, ManifestName)) {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("refusing to replace %v: it is not empty and was not created by tomato (no %v file in it)", dir, ManifestName)
+	}
+	return nil
+}
+
+// Create creates or truncates the named file under the temporary directory.
+func (o *DirOutput) Create(name string) (io.WriteCloser, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == ManifestName {
+		return nil, fmt.Errorf("%v is reserved for tomato", name)
+	}
+	fpath := filepath.Join(o.tmp, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fpath), 0775); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return nil, err
+	}
+	o.mutex.Lock()
+	o.names[name] = true
+	o.mutex.Unlock()
+	return f, nil
+}
+
+// Close writes the manifest and replaces the output directory with the temporary one.
+// On Linux both directories are exchanged atomically with renameat2.
+// Elsewhere, or on file systems that do not support it, the output directory is moved aside first,
+// so it is missing for the short time between two renames.
+func (o *DirOutput) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	names := make([]string, 0, len(o.names))
+	for name := range o.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	manifest := manifestHeader + "\n" + strings.Join(names, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(o.tmp, ManifestName), []byte(manifest), 0664); err != nil {
+		o.abort()
+		return err
+	}
+
+	// the directory may have changed since NewDirOutput
+	if err := checkReplaceable(o.dir); err != nil {
+		o.abort()
+		return err
+	}
+
+	// put the new directory in place
+	if _, err := os.Lstat(o.dir); err != nil {
+		// nothing to replace: a single rename is atomic
+		if err := os.Rename(o.tmp, o.dir); err != nil {
+			o.abort()
+			return err
+		}
+		return nil
+	}
+	err := renameExchange(o.tmp, o.dir)
+	if err == errExchangeUnsupported {
+		err = swapDirs(o.tmp, o.dir)
+	}
+	if err != nil {
+		o.abort()
+		return err
+	}
+	// the previous website is now in the temporary directory
+	return os.RemoveAll(o.tmp)
+}
+
+// errExchangeUnsupported is returned by renameExchange when the system cannot exchange two paths.
+var errExchangeUnsupported = errors.New("rename exchange not supported")
+
+// swapDirs exchanges the directories at paths a and b with three renames.
+// Unlike renameExchange it is not atomic: b briefly does not exist.
+func swapDirs(a, b string) error {
+	old := a + ".old"
+	if err := os.Rename(b, old); err != nil {
+		return err
+	}
+	if err := os.Rename(a, b); err != nil {
+		os.Rename(old, b)
+		return err
+	}
+	return os.Rename(old, a)
+}
+
+// ReadPrevious reads the named file of the directory being replaced.
+func (o *DirOutput) ReadPrevious(name string) ([]byte, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(o.dir, filepath.FromSlash(name)))
+}
+
+// Reuse links the named file of the directory being replaced into the temporary directory,
+// or copies it if it cannot be linked.
+func (o *DirOutput) Reuse(name string) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	if name == ManifestName {
+		return fmt.Errorf("%v is reserved for tomato", name)
+	}
+	src := filepath.Join(o.dir, filepath.FromSlash(name))
+	dst := filepath.Join(o.tmp, filepath.FromSlash(name))
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%v is not a regular file", src)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+		return err
+	}
+	if err := os.Link(src, dst); err != nil {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, 0664); err != nil {
+			return err
+		}
+	}
+	o.mutex.Lock()
+	o.names[name] = true
+	o.mutex.Unlock()
+	return nil
+}
+
+// Abort deletes the temporary directory, leaving the output directory untouched.
+func (o *DirOutput) Abort() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.abort()
+}
+
+func (o *DirOutput) abort() error {
+	return os.RemoveAll(o.tmp)
+}
+
+// MapOutput keeps a website in memory.
+type MapOutput struct {
+	mutex sync.Mutex
+	files map[string][]byte
+}
+
+// NewMapOutput returns an empty in-memory output.
+func NewMapOutput() *MapOutput {
+	return &MapOutput{files: make(map[string][]byte)}
+}
+
+// Create creates or truncates the named file. Its content is stored when it is closed.
+func (o *MapOutput) Create(name string) (io.WriteCloser, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedFile{close: func(content []byte) error {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		o.files[name] = append([]byte(nil), content...)
+		return nil
+	}}, nil
+}
+
+// Close does nothing.
+func (o *MapOutput) Close() error {
+	return nil
+}
+
+// Files returns the content of every file written so far, by name.
+func (o *MapOutput) Files() map[string][]byte {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	files := make(map[string][]byte, len(o.files))
+	for name, content := range o.files {
+		files[name] = content
+	}
+	return files
+}
+
+// Names returns the sorted names of the files written so far.
+func (o *MapOutput) Names() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	var names []string
+	for name := range o.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ZipOutput writes a website to a zip archive.
+type ZipOutput struct {
+	mutex    sync.Mutex
+	w        *zip.Writer
+	modified time.Time
+}
+
+// NewZipOutput returns an output writing a zip archive to w.
+// Closing the output does not close w.
+func NewZipOutput(w io.Writer) *ZipOutput {
+	return &ZipOutput{w: zip.NewWriter(w), modified: time.Now()}
+}
+
+// Create creates the named file. It is added to the archive when it is closed.
+func (o *ZipOutput) Create(name string) (io.WriteCloser, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedFile{close: func(content []byte) error {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		f, err := o.w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: o.modified})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(content)
+		return err
+	}}, nil
+}
+
+// Close writes the end of the archive.
+func (o *ZipOutput) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.w.Close()
+}
+
+// TarOutput writes a website to a tar archive.
+type TarOutput struct {
+	mutex    sync.Mutex
+	w        *tar.Writer
+	modified time.Time
+}
+
+// NewTarOutput returns an output writing a tar archive to w.
+// Closing the output does not close w.
+func NewTarOutput(w io.Writer) *TarOutput {
+	return &TarOutput{w: tar.NewWriter(w), modified: time.Now()}
+}
+
+// Create creates the named file. It is added to the archive when it is closed.
+func (o *TarOutput) Create(name string) (io.WriteCloser, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedFile{close: func(content []byte) error {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		err := o.w.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     int64(len(content)),
+			Mode:     0664,
+			ModTime:  o.modified,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = o.w.Write(content)
+		return err
+	}}, nil
+}
+
+// Close writes the end of the archive.
+func (o *TarOutput) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.w.Close()
+}
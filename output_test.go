@@ -0,0 +1,267 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles creates the given files in out, then closes it.
+func writeFiles(t *testing.T, out Output, files map[string]string) {
+	for name, content := range files {
+		f, err := out.Create(name)
+		if err != nil {
+			t.Fatalf("Create(%q): got err = %v; want nil", name, err)
+		}
+		if _, err := io.WriteString(f, content); err != nil {
+			t.Fatalf("Write(%q): got err = %v; want nil", name, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close(%q): got err = %v; want nil", name, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("Close: got err = %v; want nil", err)
+	}
+}
+
+var testOutputFiles = map[string]string{
+	"/index.html":     "index",
+	"fr/index.html":   "accueil",
+	"media/img/a.png": "png",
+}
+
+var testOutputWant = map[string]string{
+	"index.html":      "index",
+	"fr/index.html":   "accueil",
+	"media/img/a.png": "png",
+}
+
+func TestDirOutput(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	out, err := NewDirOutput(dir)
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	// a file written twice is listed once in the manifest
+	w, err := out.Create("index.html")
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	w.Close()
+	writeFiles(t, out, testOutputFiles)
+
+	for name, want := range testOutputWant {
+		if got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err != nil || string(got) != want {
+			t.Errorf("%v: got %q, %v; want %q, nil", name, got, err, want)
+		}
+	}
+	manifest, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if want := manifestHeader + "\nfr/index.html\nindex.html\nmedia/img/a.png\n"; err != nil || string(manifest) != want {
+		t.Errorf("manifest: got %q, %v; want %q, nil", manifest, err, want)
+	}
+
+	// rebuilding replaces the directory
+	out, err = NewDirOutput(dir)
+	if err != nil {
+		t.Fatalf("rebuild: got err = %v; want nil", err)
+	}
+	writeFiles(t, out, map[string]string{"index.html": "new"})
+	if _, err := os.Stat(filepath.Join(dir, "fr")); !os.IsNotExist(err) {
+		t.Errorf("rebuild: fr still exists")
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "index.html")); string(got) != "new" {
+		t.Errorf("rebuild: got index.html = %q; want %q", got, "new")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+		t.Errorf("rebuild: got %v entries next to the output; want only the output", len(entries))
+	}
+}
+
+func TestDirOutput_abort(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	out, err := NewDirOutput(dir)
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	writeFiles(t, out, map[string]string{"index.html": "old"})
+
+	out, err = NewDirOutput(dir)
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	w, err := out.Create("index.html")
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	w.Write([]byte("new"))
+	w.Close()
+	if err := out.Abort(); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, "index.html")); string(got) != "old" {
+		t.Errorf("got index.html = %q; want %q", got, "old")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+		t.Errorf("got %v entries next to the output; want only the output", len(entries))
+	}
+}
+
+func TestSwap(t *testing.T) {
+	testCases := []struct {
+		name string
+		swap func(a, b string) error
+	}{
+		{"renameExchange", renameExchange},
+		{"swapDirs", swapDirs},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			root := t.TempDir()
+			a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+			os.Mkdir(a, 0775)
+			os.Mkdir(b, 0775)
+			os.WriteFile(filepath.Join(a, "index.html"), []byte("a"), 0664)
+			os.WriteFile(filepath.Join(b, "index.html"), []byte("b"), 0664)
+			if err := tc.swap(a, b); err == errExchangeUnsupported {
+				t.Skipf("%v not supported here", tc.name)
+			} else if err != nil {
+				t.Fatalf("%v: got err = %v; want nil", tc.name, err)
+			}
+			for dir, want := range map[string]string{a: "b", b: "a"} {
+				if got, _ := os.ReadFile(filepath.Join(dir, "index.html")); string(got) != want {
+					t.Errorf("%v: got %v/index.html = %q; want %q", tc.name, filepath.Base(dir), got, want)
+				}
+			}
+			if entries, _ := os.ReadDir(root); len(entries) != 2 {
+				t.Errorf("%v: got %v entries; want 2", tc.name, len(entries))
+			}
+		})
+	}
+}
+
+func TestNewDirOutput_refuse(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "empty"), 0775)
+	os.Mkdir(filepath.Join(root, "foreign"), 0775)
+	os.WriteFile(filepath.Join(root, "foreign", "notes.txt"), []byte("precious"), 0664)
+	os.WriteFile(filepath.Join(root, "file"), []byte("precious"), 0664)
+
+	testCases := []struct {
+		dir     string
+		wantErr bool
+	}{
+		{"new", false},
+		{"empty", false},
+		{"foreign", true},
+		{"file", true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			out, err := NewDirOutput(filepath.Join(root, tc.dir))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got err = %v; want error: %v", err, tc.wantErr)
+			}
+			if out != nil {
+				out.Abort()
+			}
+		})
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "foreign", "notes.txt")); string(got) != "precious" {
+		t.Errorf("foreign directory was modified")
+	}
+}
+
+func TestMapOutput(t *testing.T) {
+	out := NewMapOutput()
+	writeFiles(t, out, testOutputFiles)
+
+	got := make(map[string]string)
+	for name, content := range out.Files() {
+		got[name] = string(content)
+	}
+	if !reflect.DeepEqual(got, testOutputWant) {
+		t.Errorf("got %v; want %v", got, testOutputWant)
+	}
+	if names := out.Names(); !reflect.DeepEqual(names, []string{"fr/index.html", "index.html", "media/img/a.png"}) {
+		t.Errorf("got names %v", names)
+	}
+}
+
+func TestZipOutput(t *testing.T) {
+	var buf bytes.Buffer
+	writeFiles(t, NewZipOutput(&buf), testOutputFiles)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	got := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("got err = %v; want nil", err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(content)
+	}
+	if !reflect.DeepEqual(got, testOutputWant) {
+		t.Errorf("got %v; want %v", got, testOutputWant)
+	}
+}
+
+func TestTarOutput(t *testing.T) {
+	var buf bytes.Buffer
+	writeFiles(t, NewTarOutput(&buf), testOutputFiles)
+
+	r := tar.NewReader(&buf)
+	got := make(map[string]string)
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("got err = %v; want nil", err)
+		}
+		content, _ := io.ReadAll(r)
+		got[hdr.Name] = string(content)
+	}
+	if !reflect.DeepEqual(got, testOutputWant) {
+		t.Errorf("got %v; want %v", got, testOutputWant)
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+		err  bool
+	}{
+		{"index.html", "index.html", false},
+		{"/fr/index.html", "fr/index.html", false},
+		{"../../etc/passwd", "etc/passwd", false},
+		{"/", "", true},
+		{"", "", true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			got, err := cleanName(tc.name)
+			if got != tc.want || (err != nil) != tc.err {
+				t.Errorf("got %q, %v; want %q, error: %v", got, err, tc.want, tc.err)
+			}
+		})
+	}
+}
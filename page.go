@@ -2,50 +2,98 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/qor/i18n"
 )
 
 // Page is the representation of a single page.
 // Basename is the bit that goes in the URL.
+// Source is the path of the markdown file of the page in the input, like `pages/blog/post.en.md`,
+// empty for the pages generated by tomato.
 // PathToFeaturedImage should be a URL to an image that will serve as header for this page.
+// Params holds the custom meta-data of the page, along with those of its categories it does not override.
+// Pager is set on the index pages generated for categories.
+// Date is when the page was published and Updated when it was last changed, both zero if unknown.
+// Expires is when the page stops being published, zero if never.
+// Draft pages only exist in builds with drafts, where templates can mark them;
+// secret is set for those written to an unguessable URL, see draftBasename.
+// Untranslated pages show the content of Original, their version in the default locale,
+// in a locale the page is not translated to yet, see Category.fallback.
 type Page struct {
 	ID                  string
 	Category            *Category
 	Basename            string
+	Source              string
 	Title               string
 	ShortSummary        string
 	Authors             []*Author
-	Date                string
+	Date                time.Time
+	Updated             time.Time
+	Expires             time.Time
 	Tags                []string
-	Draft               bool // page won’t exist at all
+	Draft               bool
 	Unlisted            bool // page will exist but will not appear in Recent Pages, tags or category pages, or menus
 	Content             []byte
 	PathToFeaturedImage string
 	Locale              string
+	Params              map[string]interface{}
+	Pager               *Pager `json:"-"`
+	Untranslated        bool
+	Original            *Page `json:"-"`
+	secret              bool
 }
 
-// NewCategoryPage creates an index page for a category.
-func NewCategoryPage(cat *Category, siteinfo *Siteinfo, locales *i18n.I18n, locale string) *Page {
-	return &Page{
-		ID:           "index",
-		Category:     cat,
-		Basename:     "index",
-		Title:        string(locales.T(locale, "categories.page_list_name", cat.Locales[locale].Name)),
-		ShortSummary: string(locales.T(locale, "categories.page_list_name", cat.Locales[locale].Name)),
-		Authors:      []*Author{&siteinfo.Authors[0]},
-		Tags:         cat.Tags(locale),
-		Unlisted:     true,
-		Content:      []byte("# {{ .Page.Title }}\n{{ template \"PageList\" . }}"),
-		Locale:       locale,
+// NewCategoryPage creates the index pages for a category, each listing a chunk of its pages given by its Pager.
+// The first one is `index.html`, the other ones `page/2.html`, `page/3.html`…
+func NewCategoryPage(cat *Category, siteinfo *Siteinfo, locales *i18n.I18n, locale string) []*Page {
+	pagers := newPagers(cat.RecentPages(-1, locale), cat.pageSize(siteinfo, locale))
+	var authors []*Author
+	if len(siteinfo.Authors) > 0 {
+		authors = []*Author{&siteinfo.Authors[0]}
 	}
+	pages := make([]*Page, len(pagers))
+	for i, pager := range pagers {
+		pages[i] = &Page{
+			ID:           pagerBasename(pager.Number),
+			Category:     cat,
+			Basename:     pagerBasename(pager.Number),
+			Title:        string(locales.T(locale, "categories.page_list_name", cat.Locales[locale].Name)),
+			ShortSummary: string(locales.T(locale, "categories.page_list_name", cat.Locales[locale].Name)),
+			Authors:      authors,
+			Tags:         cat.Tags(locale),
+			Unlisted:     true,
+			Content:      []byte("# {{ .Page.Title }}\n{{ template \"PageList\" . }}"),
+			Locale:       locale,
+			Params:       cat.Locales[locale].Params,
+			Pager:        pager,
+		}
+		pager.indexes = pages
+	}
+	return pages
+}
+
+// lastModified returns when the page was last changed: Updated if it is after Date, or else Date.
+func (page *Page) lastModified() time.Time {
+	if page.Updated.After(page.Date) {
+		return page.Updated
+	}
+	return page.Date
+}
+
+// IsIndex tells whether the page is an index page of its category, paginated ones included.
+func (page *Page) IsIndex() bool {
+	return page.Basename == "index" || page.Pager != nil
 }
 
 // ContentHelper prints the page in html.
@@ -72,7 +120,7 @@ func (page Page) Excerpt() string {
 // PathHelper prints the path from the root to the current page in html.
 func (page Page) PathHelper(curPage Page, locale, localePath string) string {
 	var str string
-	if page.Basename != "index" {
+	if !page.IsIndex() {
 		str = fmt.Sprintf("<a href=\"%s\">%s</a>", path.Join(curPage.PathToRoot(localePath), localePath, page.Path()), page.Title)
 	}
 	cat := page.Category
@@ -128,26 +176,38 @@ func (page *Page) Path() string {
 }
 
 // PathInLocale returns the path to the version of the page in a different locale, without the localePath.
+// Drafts at secret URLs are only given to other drafts at secret URLs, so that published pages do not link to them.
 func (page *Page) PathInLocale(locale string) string {
-	// return self path if locale doesn’t change
+	if curPage := page.inLocale(locale); curPage != nil {
+		return curPage.Path()
+	}
+	return ""
+}
+
+// inLocale returns the version of the page in a locale, untranslated ones included, or nil if there is none.
+func (page *Page) inLocale(locale string) *Page {
+	// return self if locale doesn’t change
 	if locale == page.Locale {
-		return page.Path()
+		return page
 	}
 
-	// if locale doesn’t exist, return empty string
+	// if locale doesn’t exist, return nil
 	if _, ok := page.Category.Locales[locale]; !ok {
-		return ""
+		return nil
 	}
 
 	// look for page in other locales
 	for _, curPage := range page.Category.Locales[locale].Pages {
+		if curPage.secret && !page.secret {
+			continue
+		}
 		if curPage.ID == page.ID && curPage.Category == page.Category {
-			return curPage.Path()
+			return curPage
 		}
 	}
 
 	// nothing found
-	return ""
+	return nil
 }
 
 // PathToRoot returns a series of '..' in a string to give a relative path from this page to the root of the website.
@@ -158,3 +218,11 @@ func (page *Page) PathToRoot(localePath string) string {
 	}
 	return str
 }
+
+// draftBasename returns the basename of a draft at an unguessable URL: its basename followed by a token
+// made from the secret and the source path of the page, so that the URL stays the same from one build to another.
+func draftBasename(basename, secret, fpath string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fpath))
+	return basename + "-" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -2,7 +2,7 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
 	"fmt"
@@ -19,7 +19,7 @@ func TestPage_ContentHelper(t *testing.T) {
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.page.ContentHelper(); got != tc.want {
+			if got := tc.page.ContentHelper("/"); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -28,19 +28,19 @@ func TestPage_ContentHelper(t *testing.T) {
 
 func TestPage_PathHelper(t *testing.T) {
 	testCases := []struct {
-		page Page
+		page *Page
 		want string
 	}{
-		{Page{Basename: "index"}, ""},
-		{Page{Basename: "index", Category: &Category{}}, "<a href=\"./index.html\"></a>"},
-		{Page{Basename: "index", Category: &Category{Name: "Category"}}, "<a href=\"./index.html\">Category</a>"},
-		{Page{Basename: "test", Title: "Test"}, "<a href=\"./test.html\">Test</a>"},
-		{Page{Basename: "test", Title: "Test", Category: &Category{}}, "<a href=\"./index.html\"></a> &gt; <a href=\"./test.html\">Test</a>"},
-		{Page{Basename: "test", Title: "Test", Category: &Category{Name: "Category"}}, "<a href=\"./index.html\">Category</a> &gt; <a href=\"./test.html\">Test</a>"},
+		{&Page{Basename: "index"}, ""},
+		{testCategory(CategoryLocaleData{Pages: []*Page{{Basename: "index"}}}).Locales["en"].Pages[0], "<a href=\"index.html\"></a>"},
+		{testCategory(CategoryLocaleData{Name: "Category", Pages: []*Page{{Basename: "index"}}}).Locales["en"].Pages[0], "<a href=\"index.html\">Category</a>"},
+		{&Page{Basename: "test", Title: "Test"}, "<a href=\"test.html\">Test</a>"},
+		{testCategory(CategoryLocaleData{Pages: []*Page{{Basename: "test", Title: "Test"}}}).Locales["en"].Pages[0], "<a href=\"index.html\"></a> &gt; <a href=\"test.html\">Test</a>"},
+		{testCategory(CategoryLocaleData{Name: "Category", Pages: []*Page{{Basename: "test", Title: "Test"}}}).Locales["en"].Pages[0], "<a href=\"index.html\">Category</a> &gt; <a href=\"test.html\">Test</a>"},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.page.PathHelper(tc.page); got != tc.want {
+			if got := tc.page.PathHelper(*tc.page, "en", "/"); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -54,6 +54,7 @@ func TestPage_Path(t *testing.T) {
 	}{
 		{&Page{}, "/.html"},
 		{&Page{Basename: "page"}, "/page.html"},
+		{testCategory(CategoryLocaleData{}, testCategory(CategoryLocaleData{Basename: "cat", Pages: []*Page{{Basename: "page"}}})).SubCategories[0].Locales["en"].Pages[0], "/cat/page.html"},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
@@ -64,18 +65,52 @@ func TestPage_Path(t *testing.T) {
 	}
 }
 
+func TestPage_PathInLocale(t *testing.T) {
+	en := &Page{ID: "foo", Basename: "english", Locale: "en"}
+	fr := &Page{ID: "foo", Basename: "francais", Locale: "fr"}
+	alone := &Page{ID: "bar", Basename: "alone", Locale: "en"}
+	cat := &Category{Locales: map[string]*CategoryLocaleData{
+		"en": {Pages: []*Page{en, alone}},
+		"fr": {Pages: []*Page{fr}},
+	}}
+	for _, page := range []*Page{en, fr, alone} {
+		page.Category = cat
+	}
+
+	testCases := []struct {
+		page   *Page
+		locale string
+		want   string
+	}{
+		{en, "en", "/english.html"},
+		{en, "fr", "/francais.html"},
+		{fr, "en", "/english.html"},
+		{alone, "fr", ""},
+		{en, "de", ""},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := tc.page.PathInLocale(tc.locale); got != tc.want {
+				t.Errorf("got %s; want %s", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestPage_PathToRoot(t *testing.T) {
 	testCases := []struct {
-		page *Page
-		want string
+		page       *Page
+		localePath string
+		want       string
 	}{
-		{&Page{}, "."},
-		{&Page{Category: &Category{}}, "."},
-		{&Page{Category: &Category{Parent: &Category{}}}, "./.."},
+		{&Page{}, "/", "."},
+		{testCategory(CategoryLocaleData{Pages: []*Page{{}}}).Locales["en"].Pages[0], "/", "."},
+		{testCategory(CategoryLocaleData{}, testCategory(CategoryLocaleData{Basename: "sub", Pages: []*Page{{}}})).SubCategories[0].Locales["en"].Pages[0], "/", "./.."},
+		{&Page{}, "/fr", "./.."},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.page.PathToRoot(); got != tc.want {
+			if got := tc.page.PathToRoot(tc.localePath); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -0,0 +1,91 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"path"
+)
+
+// Pager splits the pages listed by the index of a category into several index pages:
+// `index.html`, then `page/2.html`, `page/3.html`…
+// Number is the position of the current index page, from 1 to Count, and Pages holds the pages it lists.
+type Pager struct {
+	Number  int
+	Count   int
+	Pages   []*Page
+	indexes []*Page
+}
+
+// pageSize returns the number of pages listed by each index page of a category in a locale:
+// the page size of the category, or else that of its closest parent, or else that of the website.
+// Zero means all pages are listed on a single index page.
+func (cat *Category) pageSize(siteinfo *Siteinfo, locale string) int {
+	for ; cat != nil; cat = cat.Parent {
+		if size := cat.Locales[locale].PageSize; size > 0 {
+			return size
+		}
+	}
+	return siteinfo.PageSize
+}
+
+// newPagers splits pages in chunks of size pages and returns the pagers of the index pages listing them.
+// There is always at least one pager, even with no pages.
+func newPagers(pages []*Page, size int) []*Pager {
+	count := 1
+	if size > 0 && len(pages) > size {
+		count = (len(pages) + size - 1) / size
+	}
+	pagers := make([]*Pager, count)
+	for i := range pagers {
+		pagers[i] = &Pager{Number: i + 1, Count: count, Pages: pages}
+		if count > 1 {
+			end := (i + 1) * size
+			if end > len(pages) {
+				end = len(pages)
+			}
+			pagers[i].Pages = pages[i*size : end]
+		}
+	}
+	return pagers
+}
+
+// pagerBasename returns the basename of the index page of the given number.
+func pagerBasename(n int) string {
+	if n == 1 {
+		return "index"
+	}
+	return fmt.Sprintf("page/%d", n)
+}
+
+// URL returns the relative URL from the current index page to the index page of the given number,
+// or "" if there is no such page.
+func (pager *Pager) URL(n int, localePath string) string {
+	if pager == nil || n < 1 || n > len(pager.indexes) {
+		return ""
+	}
+	curPage := pager.indexes[pager.Number-1]
+	return path.Join(curPage.PathToRoot(localePath), localePath, pager.indexes[n-1].Path())
+}
+
+// FirstURL returns the relative URL of the first index page.
+func (pager *Pager) FirstURL(localePath string) string {
+	return pager.URL(1, localePath)
+}
+
+// PrevURL returns the relative URL of the previous index page, or "" on the first one.
+func (pager *Pager) PrevURL(localePath string) string {
+	return pager.URL(pager.Number-1, localePath)
+}
+
+// NextURL returns the relative URL of the next index page, or "" on the last one.
+func (pager *Pager) NextURL(localePath string) string {
+	return pager.URL(pager.Number+1, localePath)
+}
+
+// LastURL returns the relative URL of the last index page.
+func (pager *Pager) LastURL(localePath string) string {
+	return pager.URL(pager.Count, localePath)
+}
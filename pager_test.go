@@ -0,0 +1,121 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestNewPagers(t *testing.T) {
+	pages := []*Page{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}}
+	testCases := []struct {
+		pages []*Page
+		size  int
+		want  [][]*Page
+	}{
+		{pages, 0, [][]*Page{pages}},
+		{pages, 5, [][]*Page{pages}},
+		{pages, 2, [][]*Page{pages[0:2], pages[2:4], pages[4:5]}},
+		{nil, 2, [][]*Page{nil}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			pagers := newPagers(tc.pages, tc.size)
+			var got [][]*Page
+			for i, pager := range pagers {
+				if pager.Number != i+1 || pager.Count != len(pagers) {
+					t.Errorf("got pager %v of %v at position %v of %v", pager.Number, pager.Count, i+1, len(pagers))
+				}
+				got = append(got, pager.Pages)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPager_URL(t *testing.T) {
+	siteinfo := &Siteinfo{Authors: []Author{{Name: "A"}}}
+	cat := testCategory(CategoryLocaleData{Basename: "blog", PageSize: 1})
+	cat.Parent = &Category{Locales: map[string]*CategoryLocaleData{"en": {}}}
+	for _, id := range []string{"a", "b", "c"} {
+		cat.Locales["en"].Pages = append(cat.Locales["en"].Pages, &Page{ID: id, Basename: id, Category: cat, Locale: "en", Date: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)})
+	}
+	locales, err := LoadLocales(fstest.MapFS{"en.yml": {Data: []byte("en:\n    categories:\n        page_list_name: \"{{$1}}\"\n")}}, ".")
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	pages := NewCategoryPage(cat, siteinfo, locales, "en")
+	if len(pages) != 3 {
+		t.Fatalf("got %v index pages; want 3", len(pages))
+	}
+
+	testCases := []struct {
+		page                    *Page
+		path                    string
+		first, prev, next, last string
+	}{
+		{pages[0], "/blog/index.html", "../../fr/blog/index.html", "", "../../fr/blog/page/2.html", "../../fr/blog/page/3.html"},
+		{pages[1], "/blog/page/2.html", "../../../fr/blog/index.html", "../../../fr/blog/index.html", "../../../fr/blog/page/3.html", "../../../fr/blog/page/3.html"},
+		{pages[2], "/blog/page/3.html", "../../../fr/blog/index.html", "../../../fr/blog/page/2.html", "", "../../../fr/blog/page/3.html"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := tc.page.Path(); got != tc.path {
+				t.Errorf("got path %v; want %v", got, tc.path)
+			}
+			pager := tc.page.Pager
+			if len(pager.Pages) != 1 || pager.Pages[0] != cat.Locales["en"].Pages[tci] {
+				t.Errorf("got pages %v; want only %v", pager.Pages, cat.Locales["en"].Pages[tci].ID)
+			}
+			got := []string{pager.FirstURL("/fr"), pager.PrevURL("/fr"), pager.NextURL("/fr"), pager.LastURL("/fr")}
+			if want := []string{tc.first, tc.prev, tc.next, tc.last}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBuild_pagination(t *testing.T) {
+	input := fstest.MapFS{
+		"siteinfo.json":            {Data: []byte(`{"pageSize": 2, "locales": {"en": {"path": "/"}}, "authors": [{"name": "A"}]}`)},
+		"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+		"pages/e.en.md":            {Data: []byte("---\ndate: 2018-01-05\n---\n# E")},
+		"pages/blog/catinfo.json":  {Data: []byte(`{"name": "Blog", "pageSize": 3}`)},
+		"pages/blog/a.en.md":       {Data: []byte("---\ndate: 2018-01-01\ntags: t\n---\n# A")},
+		"pages/blog/b.en.md":       {Data: []byte("---\ndate: 2018-01-02\ntags: t\n---\n# B")},
+		"pages/blog/c.en.md":       {Data: []byte("---\ndate: 2018-01-03\ntags: t\n---\n# C")},
+		"pages/blog/d.en.md":       {Data: []byte("---\ndate: 2018-01-04\n---\n# D")},
+		"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ with .Page.Pager }}{{ .Number }}/{{ .Count }}:{{ range .Pages }} {{ .Title }}{{ end }}{{ end }}{{ end }}`)},
+		"templates/locales/en.yml": {Data: []byte("en:\n    categories:\n        page_list_name: \"{{$1}}\"\n")},
+	}
+	out := NewMapOutput()
+	if _, err := Build(context.Background(), Options{FS: input, Output: out}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	for name, want := range map[string]string{
+		"index.html":        "1/3: E D",
+		"page/2.html":       "2/3: C B",
+		"page/3.html":       "3/3: A",
+		"blog/index.html":   "1/2: D C B",
+		"blog/page/2.html":  "2/2: A",
+		"tag/t/index.html":  "1/2: C B",
+		"tag/t/page/2.html": "2/2: A",
+	} {
+		if got := string(out.Files()[name]); !strings.Contains(got, want) {
+			t.Errorf("%v: got %q; want %q", name, got, want)
+		}
+	}
+	if _, ok := out.Files()["blog/page/3.html"]; ok {
+		t.Errorf("got blog/page/3.html; want 2 index pages for blog")
+	}
+}
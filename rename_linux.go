@@ -0,0 +1,56 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// renameat2Trap is the renameat2 system call number for each architecture, which the syscall package lacks on some.
+var renameat2Trap = map[string]uintptr{
+	"386":      353,
+	"amd64":    316,
+	"arm":      382,
+	"arm64":    276,
+	"loong64":  276,
+	"mips":     4351,
+	"mipsle":   4351,
+	"mips64":   5311,
+	"mips64le": 5311,
+	"ppc64":    357,
+	"ppc64le":  357,
+	"riscv64":  276,
+	"s390x":    347,
+}
+
+// renameExchange atomically exchanges the files or directories at paths a and b, which must both exist.
+// It returns errExchangeUnsupported if the kernel or the file system cannot do it.
+func renameExchange(a, b string) error {
+	trap, ok := renameat2Trap[runtime.GOARCH]
+	if !ok {
+		return errExchangeUnsupported
+	}
+	pa, err := syscall.BytePtrFromString(a)
+	if err != nil {
+		return err
+	}
+	pb, err := syscall.BytePtrFromString(b)
+	if err != nil {
+		return err
+	}
+	const renameExchangeFlag = 1 << 1
+	fd := -100 // AT_FDCWD: paths are relative to the working directory
+	_, _, errno := syscall.Syscall6(trap, uintptr(fd), uintptr(unsafe.Pointer(pa)), uintptr(fd), uintptr(unsafe.Pointer(pb)), renameExchangeFlag, 0)
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOSYS, syscall.EINVAL:
+		return errExchangeUnsupported
+	}
+	return &os.LinkError{Op: "renameat2", Old: a, New: b, Err: errno}
+}
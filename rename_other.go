@@ -0,0 +1,12 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+//go:build !linux
+
+package tomato
+
+// renameExchange is only supported on Linux.
+func renameExchange(a, b string) error {
+	return errExchangeUnsupported
+}
@@ -0,0 +1,178 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchIndexName is the name of the search index, in the directory of each locale.
+const SearchIndexName = "search.json"
+
+// Search index kinds.
+const (
+	SearchIndexNone   = ""
+	SearchIndexPrefix = "prefix"
+	SearchIndexNgram  = "ngram"
+)
+
+// SearchConfig is the `search` object of siteinfo.json.
+// The search index of a locale lists its pages with their text, unless Disabled is set.
+// Index precomputes the pages matching every word prefix or every n-gram of words instead of holding the text,
+// which keeps the index of large websites compact since it grows with their vocabulary rather than their text:
+// Length is then the minimum length of prefixes, or the size of n-grams, 3 by default.
+type SearchConfig struct {
+	Disabled bool   `json:"disabled"`
+	Index    string `json:"index"`
+	Length   int    `json:"length"`
+}
+
+// length returns the configured length of prefixes or n-grams, or the default one.
+func (sc SearchConfig) length() int {
+	if sc.Length <= 0 {
+		return 3
+	}
+	return sc.Length
+}
+
+// check returns an error if the index kind is unknown.
+func (sc SearchConfig) check() error {
+	switch sc.Index {
+	case SearchIndexNone, SearchIndexPrefix, SearchIndexNgram:
+		return nil
+	}
+	return fmt.Errorf("unknown search index %q, want prefix or ngram", sc.Index)
+}
+
+// searchIndex is the content of a search index.
+// Index maps prefixes or n-grams to the positions of the pages in Pages.
+// Prefixes are MaxLength runes long at most.
+type searchIndex struct {
+	Kind      string           `json:"kind,omitempty"`
+	Length    int              `json:"length,omitempty"`
+	MaxLength int              `json:"maxLength,omitempty"`
+	Pages     []searchPage     `json:"pages"`
+	Index     map[string][]int `json:"index,omitempty"`
+}
+
+// searchPage is a page in a search index.
+type searchPage struct {
+	Title   string   `json:"title"`
+	Path    string   `json:"path"`
+	Tags    []string `json:"tags,omitempty"`
+	Authors []string `json:"authors,omitempty"`
+	Date    string   `json:"date,omitempty"`
+	Text    string   `json:"text,omitempty"`
+}
+
+// generateSearchIndex writes the search index of a locale to out.
+func generateSearchIndex(s *Site, out Output, locale string, cache *buildCache) error {
+	if s.Siteinfo.Search.Disabled {
+		return nil
+	}
+	name := path.Join(s.Siteinfo.Locales[locale].Path, SearchIndexName)
+	if kept, err := cache.keep(name, cache.categoryKey(s.Tree, locale, name)); kept || err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(newSearchIndex(&s.Siteinfo, s.Tree, locale))
+	if err != nil {
+		return err
+	}
+	return writeFile(out, name, data)
+}
+
+var templateActionRE = regexp.MustCompile("{{[^{}]*}}")
+
+// newSearchIndex lists the listed pages of a locale, with their text or in the configured index.
+func newSearchIndex(siteinfo *Siteinfo, tree *Category, locale string) *searchIndex {
+	config := siteinfo.Search
+	index := &searchIndex{Kind: config.Index, Pages: []searchPage{}}
+	if config.Index != SearchIndexNone {
+		index.Length = config.length()
+		index.Index = make(map[string][]int)
+	}
+	if config.Index == SearchIndexPrefix {
+		index.MaxLength = maxSearchPrefix
+	}
+	for _, page := range individualPages(tree, locale) {
+		// generated index pages only list other pages
+		if page.Unlisted || page.Draft || page.Untranslated || !page.isListed(locale) {
+			continue
+		}
+		sp := searchPage{
+			Title: page.Title,
+			Path:  path.Join(siteinfo.Locales[locale].Path, page.Path()),
+			Tags:  page.Tags,
+			Date:  formatDate(nil, locale, page.Date, "2006-01-02"),
+		}
+		for _, author := range page.Authors {
+			sp.Authors = append(sp.Authors, author.Name)
+		}
+		text := html.UnescapeString(templateActionRE.ReplaceAllString(string(Raw(page.Content)), ""))
+		text = strings.Join(strings.Fields(text), " ")
+
+		i := len(index.Pages)
+		switch config.Index {
+		case SearchIndexNone:
+			sp.Text = text
+		case SearchIndexPrefix, SearchIndexNgram:
+			words := searchWords(strings.Join(append(append([]string{page.Title, text}, page.Tags...), sp.Authors...), " "))
+			for _, key := range searchKeys(words, config.Index, index.Length) {
+				index.Index[key] = append(index.Index[key], i)
+			}
+		}
+		index.Pages = append(index.Pages, sp)
+	}
+	return index
+}
+
+// searchWords splits a text into lower case words of letters and digits.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// maxSearchPrefix is the length of the longest prefixes of a prefix index.
+// Longer words are looked up by their prefix of this length.
+const maxSearchPrefix = 12
+
+// searchKeys returns the sorted distinct prefixes or n-grams of words.
+// Words no longer than length are keys on their own.
+func searchKeys(words []string, kind string, length int) []string {
+	set := make(map[string]bool)
+	for _, word := range words {
+		runes := []rune(word)
+		if len(runes) <= length {
+			set[word] = true
+			continue
+		}
+		switch kind {
+		case SearchIndexPrefix:
+			for n := length; n <= len(runes) && n <= maxSearchPrefix; n++ {
+				set[string(runes[:n])] = true
+			}
+		case SearchIndexNgram:
+			for i := 0; i+length <= len(runes); i++ {
+				set[string(runes[i:i+length])] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
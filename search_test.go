@@ -0,0 +1,88 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGenerateSearchIndex(t *testing.T) {
+	testCases := []struct {
+		search string
+		want   searchIndex
+	}{
+		{`{}`, searchIndex{Pages: []searchPage{
+			{Title: "Hello", Path: "/index.html", Authors: []string{"A"}, Date: "2018-01-01", Text: "world & co"},
+			{Title: "Post", Path: "/blog/post.html", Tags: []string{"t"}, Date: "2018-01-02", Text: "Café"},
+		}}},
+		{`{"index": "prefix", "length": 4}`, searchIndex{Kind: "prefix", Length: 4, MaxLength: maxSearchPrefix,
+			Pages: []searchPage{
+				{Title: "Hello", Path: "/index.html", Authors: []string{"A"}, Date: "2018-01-01"},
+				{Title: "Post", Path: "/blog/post.html", Tags: []string{"t"}, Date: "2018-01-02"},
+			},
+			Index: map[string][]int{"a": {0}, "co": {0}, "hell": {0}, "hello": {0}, "worl": {0}, "world": {0}, "café": {1}, "post": {1}, "t": {1}},
+		}},
+		{`{"disabled": true}`, searchIndex{}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			input := fstest.MapFS{
+				"siteinfo.json":             {Data: []byte(`{"search": ` + tc.search + `, "locales": {"en": {"path": "/"}}, "authors": [{"name": "A"}]}`)},
+				"pages/catinfo.json":        {Data: []byte(`{"name": "Home"}`)},
+				"pages/index.en.md":         {Data: []byte("---\nauthor: A\ndate: 2018-01-01\n---\n# Hello\n*world* &amp; {{ .Locale }}co")},
+				"pages/blog/catinfo.json":   {Data: []byte(`{"name": "Blog"}`)},
+				"pages/blog/post.en.md":     {Data: []byte("---\ndate: 2018-01-02\ntags: t\n---\n# Post\nCafé")},
+				"pages/hidden/catinfo.json": {Data: []byte(`{"name": "Hidden", "unlisted": true}`)},
+				"pages/hidden/secret.en.md": {Data: []byte("# Secret")},
+				"templates/page.html":       {Data: []byte(`{{ define "Header" }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+				"templates/locales/en.yml":  {Data: []byte("en:\n    categories:\n        page_list_name: \"{{$1}}\"\n")},
+			}
+			out := NewMapOutput()
+			if _, err := Build(context.Background(), Options{FS: input, Output: out}); err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			data, ok := out.Files()[SearchIndexName]
+			if tc.want.Pages == nil {
+				if ok {
+					t.Errorf("got a search index; want none")
+				}
+				return
+			}
+			var got searchIndex
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchKeys(t *testing.T) {
+	testCases := []struct {
+		words  []string
+		kind   string
+		length int
+		want   []string
+	}{
+		{[]string{"tomato", "to"}, SearchIndexPrefix, 3, []string{"to", "tom", "toma", "tomat", "tomato"}},
+		{[]string{"tomato", "to"}, SearchIndexNgram, 3, []string{"ato", "mat", "oma", "to", "tom"}},
+		{[]string{"générateur"}, SearchIndexNgram, 8, []string{"générate", "nérateur", "énérateu"}},
+		{[]string{"internationalization"}, SearchIndexPrefix, 11, []string{"internation", "internationa"}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := searchKeys(tc.words, tc.kind, tc.length); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,604 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/qor/i18n"
+)
+
+// Site holds a website loaded from its input, ready to be generated.
+// FS is the input, Translations holds the locale files of the templates.
+// Future and Expired hold the source paths of the pages held back because they are dated in the future
+// or past their expiry date, SecretDrafts the drafts written to unguessable URLs.
+type Site struct {
+	FS           fs.FS
+	Siteinfo     Siteinfo
+	Tree         *Category
+	Translations *i18n.I18n
+	Templates    *template.Template
+	Future       []string
+	Expired      []string
+	SecretDrafts []*Page
+}
+
+// LoadSite reads siteinfo.json, the categories, the pages and the templates of a website.
+func LoadSite(ctx context.Context, opts Options) (*Site, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	log := opts.logger()
+
+	// load /siteinfo.json
+	log.Section("Loading %v...", opts.configName())
+	siteinfo, err := opts.loadSiteinfo()
+	if err != nil {
+		return nil, err
+	}
+	for _, locale := range opts.Locales {
+		if _, ok := siteinfo.Locales[locale]; !ok {
+			return nil, fmt.Errorf("locale %q is not defined in %v", locale, opts.configName())
+		}
+	}
+	log.Printf("Done, %v locales, %v authors found.", len(siteinfo.Locales), len(siteinfo.Authors))
+
+	registerCLDRLocales(siteinfo)
+	if unsupported := unsupportedCLDRLocales(siteinfo); len(unsupported) > 0 {
+		log.Printf("No CLDR data for %v: dates, numbers and plurals are formatted as in English.", strings.Join(unsupported, ", "))
+	}
+
+	// load template locales
+	locales, err := LoadLocales(opts.FS, "templates/locales")
+	if err != nil {
+		return nil, err
+	}
+
+	// initialize empty tree
+	tree := NewCategory(siteinfo)
+
+	// read category files (all catinfo.json)
+	log.Section("Loading categories...")
+	err = WalkDir(opts.FS, "pages", func(fpath string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path.Base(fpath) == "catinfo.json" {
+			// load file content
+			content, err := fs.ReadFile(opts.FS, fpath)
+			if err != nil {
+				return err
+			}
+
+			// create category struct
+			cat := NewCategory(siteinfo)
+
+			// find path and Basename
+			catinfoPath := fpath
+			fpath = path.Dir(strings.TrimPrefix(fpath, "pages"))
+			basename := path.Base(fpath)
+			cat.Realname = basename
+			if fpath == "/" {
+				fpath = ":root:"
+			}
+
+			// try json => CategoryLocaleData
+			var locale string
+			for l := range siteinfo.Locales {
+				locale = l
+				break
+			}
+			err = json.Unmarshal(content, cat.Locales[locale])
+			if err == nil && len(cat.Locales[locale].Name) > 0 {
+				// put this value in all locales
+				for l := range siteinfo.Locales {
+					if l != locale {
+						*cat.Locales[l] = *cat.Locales[locale]
+					}
+				}
+			} else {
+				// try json => Category
+				cat.Locales[locale] = &CategoryLocaleData{}
+				err = json.Unmarshal(content, &cat.Locales)
+				if err != nil {
+					return fmt.Errorf("%v: %v", catinfoPath, err)
+				}
+			}
+
+			// set basename where not set yet
+			for locale := range siteinfo.Locales {
+				if cat.Locales[locale].Basename == "" {
+					cat.Locales[locale].Basename = basename
+				}
+			}
+
+			// locate parent
+			parent, err := tree.FindParent(fpath)
+			if err != nil {
+				return fmt.Errorf("%v: no parent category found, a directory has no catinfo.json", catinfoPath)
+			}
+
+			if parent == nil {
+				// parent is nil: this is the root category
+				for locale := range siteinfo.Locales {
+					*tree.Locales[locale] = *cat.Locales[locale]
+				}
+			} else {
+				// parent is not nil: insert category
+				parent.SubCategories = append(parent.SubCategories, cat)
+				cat.Parent = parent
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for locale := range siteinfo.Locales {
+		log.Printf("%v: %v categories found", locale, 1+tree.CategoryCount(locale))
+	}
+
+	// read page files (*.md)
+	log.Section("Loading pages...")
+	now := opts.now()
+	var future, expired []string
+	var secretDrafts []*Page
+	err = WalkDir(opts.FS, "pages", func(fpath string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if strings.HasSuffix(path.Base(fpath), ".md") {
+			locale, id, basename, err := splitPageName(siteinfo, fpath)
+			if err != nil {
+				return err
+			}
+
+			// load file content
+			content, err := fs.ReadFile(opts.FS, fpath)
+			if err != nil {
+				return err
+			}
+
+			// parse meta and remove them from content
+			fm, content, err := ParseFrontMatter(content)
+			if err != nil {
+				return fmt.Errorf("%v: %v", fpath, err)
+			}
+			if fm.Title == "" {
+				fm.Title = firstHeading(content)
+			}
+			if fm.Draft && !opts.Drafts {
+				log.Verbosef("Skipping draft: ‘%s’", fpath)
+				return nil
+			}
+
+			featuredImageLinkRE := regexp.MustCompile("!!\\[(.+)\\]\\((.+)\\)")
+			if submatches := featuredImageLinkRE.FindSubmatch(content); fm.FeaturedImage == "" && len(submatches) >= 2 {
+				fm.FeaturedImage = string(submatches[2])
+			}
+			content = featuredImageLinkRE.ReplaceAll(content, []byte("![$1]($2)"))
+
+			date, err := parseDate(fm.Date, siteinfo.location())
+			if err != nil {
+				return fmt.Errorf("%v: date: %v", fpath, err)
+			}
+			updated, err := parseDate(fm.Updated, siteinfo.location())
+			if err != nil {
+				return fmt.Errorf("%v: updated: %v", fpath, err)
+			}
+			expires, err := parseDate(fm.Expires, siteinfo.location())
+			if err != nil {
+				return fmt.Errorf("%v: expires: %v", fpath, err)
+			}
+
+			// scheduled and expired pages
+			if date.After(now) && !opts.Future {
+				log.Verbosef("Holding back future page: ‘%s’", fpath)
+				future = append(future, fpath)
+				return nil
+			}
+			unlisted := false
+			if !expires.IsZero() && !expires.After(now) {
+				expired = append(expired, fpath)
+				if siteinfo.Expired != "unlist" {
+					log.Verbosef("Removing expired page: ‘%s’", fpath)
+					return nil
+				}
+				log.Verbosef("Unlisting expired page: ‘%s’", fpath)
+				unlisted = true
+			}
+
+			// add to tree as a Page struct
+			var authors []*Author
+			for _, name := range fm.Authors {
+				author, err := siteinfo.FindAuthor(name)
+				if err != nil {
+					return fmt.Errorf("%v: %v", fpath, err)
+				}
+				authors = append(authors, author)
+			}
+			page := &Page{
+				ID:                  id,
+				Basename:            basename,
+				Source:              fpath,
+				Title:               fm.Title,
+				ShortSummary:        fm.ShortSummary,
+				Authors:             authors,
+				Date:                date,
+				Updated:             updated,
+				Expires:             expires,
+				Tags:                fm.Tags,
+				Draft:               fm.Draft,
+				Unlisted:            unlisted || fm.Unlisted,
+				Content:             content,
+				PathToFeaturedImage: fm.FeaturedImage,
+				Locale:              locale,
+				Params:              fm.Params,
+			}
+			if page.Draft && opts.DraftSecret != "" {
+				page.Basename = draftBasename(page.Basename, opts.DraftSecret, fpath)
+				page.Unlisted, page.secret = true, true
+				secretDrafts = append(secretDrafts, page)
+			}
+
+			parent, err := tree.FindParent(strings.TrimPrefix(fpath, "pages"))
+			if err != nil {
+				return fmt.Errorf("%v: no category found, a directory has no catinfo.json", fpath)
+			}
+			if parent == nil {
+				tree.Locales[locale].Pages = append(tree.Locales[locale].Pages, page)
+				page.Category = tree
+			} else {
+				parent.Locales[locale].Pages = append(parent.Locales[locale].Pages, page)
+				page.Category = parent
+			}
+
+			/*/ special title for site home page
+			if page.Category == tree && page.Basename == "index" {
+				page.Title = siteinfo.Locales[locale].Subtitle
+			}*/
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for locale := range siteinfo.Locales {
+		log.Printf("%v: %v pages found", locale, tree.PageCount(locale))
+	}
+	for locale, count := range addFallbackPages(tree, &siteinfo) {
+		log.Printf("%v: %v untranslated pages falling back to %v", locale, count, siteinfo.defaultLocale())
+	}
+	tree.inheritParams()
+
+	// create categories for tags
+	tagCat := NewCategory(siteinfo)
+	tagCat.Parent = tree
+	tagCat.Virtual = true
+	tree.SubCategories = append(tree.SubCategories, tagCat)
+	for locale := range siteinfo.Locales {
+		tagCat.Locales[locale].Basename = "tag"
+		tagCat.Locales[locale].Name = "Tags"
+		tagCat.Locales[locale].Unlisted = true
+	}
+	for locale := range siteinfo.Locales {
+	toNextTag:
+		for _, tag := range tree.Tags(locale) {
+			// skip if it was already created
+			for _, cat := range tagCat.SubCategories {
+				if cat.Locales[locale].Basename == tag {
+					continue toNextTag
+				}
+			}
+			cat := NewCategory(siteinfo)
+			cat.Parent = tagCat
+			cat.Virtual = true
+			for locale2 := range siteinfo.Locales {
+				cat.Locales[locale2].Basename = tag
+				cat.Locales[locale2].Name = tag
+				cat.Locales[locale2].Unlisted = true
+				cat.Locales[locale2].Pages = tree.FilterByTag(tag, locale2)
+			}
+			tagCat.SubCategories = append(tagCat.SubCategories, cat)
+		}
+	}
+
+	// create categories for authors
+	if len(siteinfo.Authors) > 0 {
+		authorCat := NewCategory(siteinfo)
+		authorCat.Parent = tree
+		authorCat.Virtual = true
+		tree.SubCategories = append(tree.SubCategories, authorCat)
+		for locale := range siteinfo.Locales {
+			authorCat.Locales[locale].Basename = "author"
+			authorCat.Locales[locale].Name = "Authors"
+			authorCat.Locales[locale].Unlisted = true
+		}
+		for i := range siteinfo.Authors {
+			author := &siteinfo.Authors[i]
+			cat := NewCategory(siteinfo)
+			cat.Parent = authorCat
+			cat.Virtual = true
+			cat.Author = author
+			for locale := range siteinfo.Locales {
+				cat.Locales[locale].Basename = author.Slug
+				cat.Locales[locale].Name = author.Name
+				cat.Locales[locale].Description = author.Bio[locale]
+				cat.Locales[locale].Unlisted = true
+				cat.Locales[locale].Pages = tree.FilterByAuthor(author, locale)
+			}
+			authorCat.SubCategories = append(authorCat.SubCategories, cat)
+		}
+	}
+
+	// create categories for the archive
+	archiveCat := newArchiveCategory(tree, siteinfo, locales)
+	if archiveCat != nil {
+		tree.SubCategories = append(tree.SubCategories, archiveCat)
+	}
+
+	// for each locale, make index pages for categories lacking them
+	for locale := range siteinfo.Locales {
+		for catQueue := []*Category{tree}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
+			// if there is already an index.md: do nothing
+			mustContinue := false
+			for _, page := range catQueue[0].Locales[locale].Pages {
+				if page.Basename == "index" && page.Category == catQueue[0] {
+					mustContinue = true
+					break
+				}
+			}
+			if mustContinue {
+				continue
+			}
+
+			// skip empty categories
+			if catQueue[0].PageCount(locale) == 0 && !catQueue[0].Virtual {
+				continue
+			}
+
+			// create category pages
+			for _, catPage := range NewCategoryPage(catQueue[0], &siteinfo, locales, locale) {
+				// change title for tag and author pages
+				if catPage.Category.IsUnder(tagCat) {
+					catPage.Title = string(locales.T(locale, "tags.page_list_name", catPage.Category.Locales[locale].Name))
+				}
+				if archiveCat != nil && catPage.Category.IsUnder(archiveCat) {
+					catPage.Title = string(locales.T(locale, "archive.page_list_name", catPage.Category.Locales[locale].Name))
+					if catPage.Title == "" {
+						catPage.Title = catPage.Category.Locales[locale].Name
+					}
+				}
+				if author := catPage.Category.Author; author != nil {
+					catPage.Title = string(locales.T(locale, "authors.page_list_name", author.Name))
+					if catPage.Title == "" {
+						catPage.Title = author.Name
+					}
+					catPage.Authors = []*Author{author}
+				}
+
+				// add the page to its category
+				catQueue[0].Locales[locale].Pages = append(catQueue[0].Locales[locale].Pages, catPage)
+			}
+		}
+	}
+
+	// load templates
+	templates := template.New("tomatoTemplates")
+	templates.Funcs(map[string]interface{}{
+		"t": func(locale, key string, args ...interface{}) string {
+			return string(locales.T(locale, key, args...))
+		},
+		"formatDate": func(locale string, date time.Time, layout ...string) string {
+			return formatDate(locales, locale, date, layout...)
+		},
+		"formatNumber": func(locale string, n interface{}) string {
+			return formatNumber(locale, n)
+		},
+		"plural": func(locale, key string, n interface{}) string {
+			return plural(locales, locale, key, n)
+		},
+		"join": func(paths ...string) string {
+			return path.Clean(path.Join(paths...))
+		},
+	})
+	_, err = templates.ParseFS(opts.FS, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("when parsing templates: %v", err)
+	}
+
+	return &Site{
+		FS:           opts.FS,
+		Siteinfo:     siteinfo,
+		Tree:         tree,
+		Translations: locales,
+		Templates:    templates,
+		Future:       future,
+		Expired:      expired,
+		SecretDrafts: secretDrafts,
+	}, nil
+}
+
+// splitPageName reads the locale, the ID and the basename of a page from the name of its file,
+// like `pages/00.about.en.md`. Files without a locale suffix are in the root locale.
+func splitPageName(siteinfo Siteinfo, fpath string) (locale, id, basename string, err error) {
+	for localeCandidate := range siteinfo.Locales {
+		if siteinfo.Locales[localeCandidate].Path == "/" {
+			locale = localeCandidate
+		}
+		if strings.HasSuffix(path.Base(fpath), "."+localeCandidate+".md") {
+			locale = localeCandidate
+			break
+		}
+	}
+	if locale == "" {
+		return "", "", "", fmt.Errorf("Unable to detect locale for %v", fpath)
+	}
+
+	basename = strings.TrimSuffix(strings.TrimSuffix(path.Base(fpath), ".md"), "."+locale)
+	basenameParts := strings.Split(basename, ".")
+	id = basename
+	if len(basenameParts) > 1 {
+		id = basenameParts[0]
+		basename = strings.TrimPrefix(basename, id+".")
+	}
+	return locale, id, basename, nil
+}
+
+// Generate writes the html pages and copies the resource directories of a loaded website to opts.Output,
+// or to a new DirOutput in opts.OutputDir, replacing any pre-existing directory created by tomato.
+// The output is closed once everything is written, or aborted if possible when something fails.
+func (s *Site) Generate(ctx context.Context, opts Options) (res *Result, err error) {
+	opts, err = opts.Normalize()
+	if err == nil {
+		opts, err = opts.NormalizeOutput()
+	}
+	if err != nil {
+		return nil, err
+	}
+	log := opts.logger()
+	res = &Result{Pages: make(map[string]int)}
+
+	out := opts.Output
+	if out == nil {
+		out, err = NewDirOutput(opts.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		if a, ok := out.(aborter); ok && err != nil {
+			a.Abort()
+			return
+		}
+		if closeErr := out.Close(); err == nil && closeErr != nil {
+			res, err = nil, closeErr
+		}
+	}()
+
+	cache, err := newBuildCache(s, out, opts.Clean)
+	if err != nil {
+		return nil, err
+	}
+
+	// generate the html pages for all locales
+	var locales []string
+	for locale := range s.Siteinfo.Locales {
+		if opts.generates(locale) {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		log.Section("Locale: %v, in %v", locale, s.Siteinfo.Locales[locale].Path)
+		n, err := generatePages(ctx, &s.Siteinfo, s.Tree, s.Templates, out, locale, opts.Jobs, cache)
+		if err != nil {
+			return nil, err
+		}
+		res.Pages[locale] = n
+		log.Printf("%v html files generated", n)
+
+		n, err = generateFeeds(s, out, locale, cache)
+		if err != nil {
+			return nil, err
+		}
+		res.Feeds += n
+		if n > 0 {
+			log.Verbosef("%v feeds generated", n)
+		} else if s.Siteinfo.baseURL(locale) == "" {
+			log.Verbosef("No baseURL in siteinfo.json: feeds are not generated")
+		}
+
+		if err := generateSearchIndex(s, out, locale, cache); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := generateSitemap(s, out, locales, cache)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		log.Verbosef("%v URLs in the sitemap", n)
+	}
+
+	log.Section("Copying resource directories...")
+	// copy /media and /assets
+	for _, dir := range []string{"media", "assets"} {
+		if dirExistsFS(s.FS, dir) {
+			log.Printf("Copying /%v", dir)
+			n, err := copyDir(s.FS, dir, out, cache)
+			if err != nil {
+				return nil, err
+			}
+			log.Verbosef("%v files copied", n)
+		}
+	}
+
+	if err := cache.save(); err != nil {
+		return nil, err
+	}
+	res.Reused = cache.reusedCount()
+	if res.Reused > 0 {
+		log.Printf("%v unchanged files reused from the previous build", res.Reused)
+	}
+
+	// pages held back by their dates
+	res.Future, res.Expired = s.Future, s.Expired
+	if len(s.Future) > 0 {
+		log.Printf("%v future pages held back, use --future to include them:", len(s.Future))
+		for _, fpath := range s.Future {
+			log.Printf("  %v", fpath)
+		}
+	}
+	if len(s.Expired) > 0 {
+		action := "removed"
+		if s.Siteinfo.Expired == "unlist" {
+			action = "unlisted"
+		}
+		log.Printf("%v expired pages %v:", len(s.Expired), action)
+		for _, fpath := range s.Expired {
+			log.Printf("  %v", fpath)
+		}
+	}
+	if len(s.SecretDrafts) > 0 {
+		log.Printf("%v drafts at secret URLs:", len(s.SecretDrafts))
+		for _, page := range s.SecretDrafts {
+			if !opts.generates(page.Locale) {
+				continue
+			}
+			url := s.Siteinfo.PermalinkHelper(page, page.Locale)
+			if url == "" {
+				url = path.Join(s.Siteinfo.Locales[page.Locale].Path, page.Path())
+			}
+			log.Printf("  %v", url)
+		}
+	}
+
+	return res, nil
+}
+
+// generates returns whether a locale should be generated.
+func (opts Options) generates(locale string) bool {
+	if len(opts.Locales) == 0 {
+		return true
+	}
+	for _, l := range opts.Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,18 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
+	"encoding/json"
 	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Siteinfo contains the site-wide meta. There should be only one of them.
@@ -13,19 +21,179 @@ import (
 // Description will be printed in the menu,
 // Copyright will be printed in the footer.
 // Authors must contain all possible authors for the website.
+// BaseURL is the absolute URL of the root of the website, like `https://example.com/blog`,
+// needed for permalinks and feeds.
+// PageSize is the default number of pages listed by each index page of categories, all of them if zero.
+// Timezone is the IANA name of the timezone of the dates of pages that do not give one, like `Europe/Paris`, UTC by default.
+// Expired tells what becomes of pages past their expiry date: `remove` them, the default, or `unlist` them.
+// Fallback makes the pages missing from a locale fall back to their version in the default locale, see Category.fallback.
 type Siteinfo struct {
-	Locales map[string]struct {
-		Path        string `json: "path"`
-		Title       string `json: "title"`
-		Subtitle    string `json: "subtitle"`
-		Description string `json: "description"`
-		Copyright   string `json: "copyright"`
-	} `json: "locales"`
-	Authors []Author `json: "authors"`
+	BaseURL  string                        `json:"baseURL"`
+	PageSize int                           `json:"pageSize"`
+	Locales  map[string]SiteinfoLocaleData `json:"locales"`
+	Authors  []Author                      `json:"authors"`
+	Feeds    FeedConfig                    `json:"feeds"`
+	Sitemap  SitemapConfig                 `json:"sitemap"`
+	Search   SearchConfig                  `json:"search"`
+	Timezone string                        `json:"timezone,omitempty"`
+	Expired  string                        `json:"expired,omitempty"`
+	Fallback bool                          `json:"fallback,omitempty"`
+	loc      *time.Location
 }
 
-// MainAuthorHelper prints a html link to the first author of the siteinfo.
+// SiteinfoLocaleData holds the site-wide meta that changes with the locale.
+// Path is the directory of the locale in the output, like `/` or `/fr`.
+// BaseURL, if set, replaces the one of the website for the pages of this locale,
+// for instance when each language is served on its own domain.
+type SiteinfoLocaleData struct {
+	Path        string `json:"path"`
+	BaseURL     string `json:"baseURL"`
+	Title       string `json:"title"`
+	Subtitle    string `json:"subtitle"`
+	Description string `json:"description"`
+	Copyright   string `json:"copyright"`
+}
+
+// LoadSiteinfo reads the siteinfo.json file name of fsys.
+func LoadSiteinfo(fsys fs.FS, name string) (siteinfo Siteinfo, err error) {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return siteinfo, fmt.Errorf("no %v found", name)
+	}
+	err = json.Unmarshal(content, &siteinfo)
+	if err != nil {
+		return siteinfo, fmt.Errorf("incorrect %v: %v", name, err)
+	}
+	if err := siteinfo.Feeds.check(); err != nil {
+		return siteinfo, fmt.Errorf("incorrect %v: %v", name, err)
+	}
+	if err := siteinfo.Search.check(); err != nil {
+		return siteinfo, fmt.Errorf("incorrect %v: %v", name, err)
+	}
+	if err := checkBaseURL(siteinfo.BaseURL); err != nil {
+		return siteinfo, fmt.Errorf("incorrect %v: %v", name, err)
+	}
+	if siteinfo.Timezone != "" {
+		if siteinfo.loc, err = time.LoadLocation(siteinfo.Timezone); err != nil {
+			return siteinfo, fmt.Errorf("incorrect %v: unknown timezone %q", name, siteinfo.Timezone)
+		}
+	}
+	if siteinfo.Expired != "" && siteinfo.Expired != "remove" && siteinfo.Expired != "unlist" {
+		return siteinfo, fmt.Errorf("incorrect %v: expired: got %q, want remove or unlist", name, siteinfo.Expired)
+	}
+	for locale := range siteinfo.Locales {
+		if err := checkBaseURL(siteinfo.Locales[locale].BaseURL); err != nil {
+			return siteinfo, fmt.Errorf("incorrect %v: locale %v: %v", name, locale, err)
+		}
+	}
+
+	// slugs of the authors
+	slugs := make(map[string]string)
+	for i := range siteinfo.Authors {
+		author := &siteinfo.Authors[i]
+		if author.Slug == "" {
+			author.Slug = slugify(author.Name)
+		}
+		if author.Slug == "" || author.Slug != path.Base(author.Slug) || strings.HasPrefix(author.Slug, ".") {
+			return siteinfo, fmt.Errorf("incorrect %v: author %q: invalid slug %q", name, author.Name, author.Slug)
+		}
+		if other, ok := slugs[author.Slug]; ok {
+			return siteinfo, fmt.Errorf("incorrect %v: authors %q and %q have the same slug %q", name, other, author.Name, author.Slug)
+		}
+		slugs[author.Slug] = author.Name
+	}
+	return siteinfo, nil
+}
+
+// checkBaseURL returns an error if a base URL is neither empty nor an absolute http(s) URL.
+func checkBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("baseURL %q is not an absolute http or https URL", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("baseURL %q must not have a query or a fragment", baseURL)
+	}
+	return nil
+}
+
+// baseURL returns the base URL of the website for a locale, without a trailing slash, or "" if it is unknown.
+func (siteinfo Siteinfo) baseURL(locale string) string {
+	if baseURL := siteinfo.Locales[locale].BaseURL; baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return strings.TrimSuffix(siteinfo.BaseURL, "/")
+}
+
+// absoluteURL returns the absolute URL of a path of the output, locale path included,
+// or "" if the base URL is unknown.
+func (siteinfo Siteinfo) absoluteURL(locale, p string) string {
+	baseURL := siteinfo.baseURL(locale)
+	if baseURL == "" {
+		return ""
+	}
+	return baseURL + path.Clean("/"+p)
+}
+
+// PermalinkHelper prints the absolute URL of a page, or nothing if the base URL is unknown.
+func (siteinfo Siteinfo) PermalinkHelper(page *Page, locale string) string {
+	return siteinfo.absoluteURL(locale, path.Join(siteinfo.Locales[locale].Path, page.Path()))
+}
+
+// CategoryURLHelper prints the absolute URL of the index page of a category, or nothing if the base URL is unknown.
+func (siteinfo Siteinfo) CategoryURLHelper(cat *Category, locale string) string {
+	return siteinfo.absoluteURL(locale, path.Join(siteinfo.Locales[locale].Path, cat.Path(locale), "index.html"))
+}
+
+// CanonicalHelper prints the html `<link rel="canonical">` tag of a page, or nothing if the base URL is unknown.
+// Untranslated pages point to the page they fall back to.
+func (siteinfo Siteinfo) CanonicalHelper(page *Page, locale string) string {
+	if page.Original != nil {
+		page, locale = page.Original, page.Original.Locale
+	}
+	permalink := siteinfo.PermalinkHelper(page, locale)
+	if permalink == "" {
+		return ""
+	}
+	return fmt.Sprintf("<link rel=\"canonical\" href=\"%s\">", html.EscapeString(permalink))
+}
+
+// AlternatesHelper prints the html `<link rel="alternate" hreflang>` tags of the translations of a page,
+// or nothing if the page has no other translation, is untranslated itself, or the base URL is unknown.
+func (siteinfo Siteinfo) AlternatesHelper(page *Page, locale string) string {
+	if page.Untranslated {
+		return ""
+	}
+	var locales []string
+	for locale2 := range siteinfo.Locales {
+		locales = append(locales, locale2)
+	}
+	sort.Strings(locales)
+
+	var links []string
+	for _, locale2 := range locales {
+		translation := page.inLocale(locale2)
+		if translation == nil || translation.Untranslated {
+			continue
+		}
+		if href := siteinfo.PermalinkHelper(translation, locale2); href != "" {
+			links = append(links, fmt.Sprintf("<link rel=\"alternate\" hreflang=\"%s\" href=\"%s\">", locale2, html.EscapeString(href)))
+		}
+	}
+	if len(links) < 2 {
+		return ""
+	}
+	return strings.Join(links, "\n")
+}
+
+// MainAuthorHelper prints a html link to the first author of the siteinfo, or nothing if there is none.
 func (siteinfo Siteinfo) MainAuthorHelper() string {
+	if len(siteinfo.Authors) == 0 {
+		return ""
+	}
 	return siteinfo.Authors[0].Helper()
 }
 
@@ -58,3 +226,19 @@ func (si *Siteinfo) FindAuthor(name string) (*Author, error) {
 	}
 	return nil, fmt.Errorf("unable to find author %q", name)
 }
+
+// defaultLocale returns the locale whose path is `/`, or else the first one in alphabetical order.
+func (siteinfo Siteinfo) defaultLocale() string {
+	var locales []string
+	for locale, data := range siteinfo.Locales {
+		if data.Path == "/" {
+			return locale
+		}
+		locales = append(locales, locale)
+	}
+	if len(locales) == 0 {
+		return ""
+	}
+	sort.Strings(locales)
+	return locales[0]
+}
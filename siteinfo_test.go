@@ -2,12 +2,14 @@
 // Copyright Quentin Ribac, 2018
 // Free software license can be found in the LICENSE file.
 
-package main
+package tomato
 
 import (
 	"fmt"
 	"reflect"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestSiteinfo_MainAuthorHelper(t *testing.T) {
@@ -15,7 +17,8 @@ func TestSiteinfo_MainAuthorHelper(t *testing.T) {
 		siteinfo Siteinfo
 		want     string
 	}{
-		{Siteinfo{Authors: []Author{{"A", "a"}, {"B", "b"}}}, "<address><a href=\"mailto:a\">A</a></address>"},
+		{Siteinfo{Authors: []Author{{Name: "A", Email: "a"}, {Name: "B", Email: "b"}}}, "<address><a href=\"mailto:a\">A</a></address>"},
+		{Siteinfo{}, ""},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
@@ -31,12 +34,12 @@ func TestSiteinfo_CopyrightHelper(t *testing.T) {
 		siteinfo Siteinfo
 		want     string
 	}{
-		{Siteinfo{Copyright: "test [test](test)"}, "<p>test <a href=\"test\">test</a></p>\n"},
+		{Siteinfo{Locales: map[string]SiteinfoLocaleData{"en": {Path: "/", Copyright: "test [test](test)"}}}, "<p>test <a href=\"test\">test</a></p>\n"},
 		{Siteinfo{}, ""},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.siteinfo.CopyrightHelper(&Page{}); got != tc.want {
+			if got := tc.siteinfo.CopyrightHelper(&Page{}, "en"); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -48,12 +51,12 @@ func TestSiteinfo_SubtitleHelper(t *testing.T) {
 		siteinfo Siteinfo
 		want     string
 	}{
-		{Siteinfo{Subtitle: "sous-titre [test](test)"}, "<p>sous-titre <a href=\"test\">test</a></p>\n"},
+		{Siteinfo{Locales: map[string]SiteinfoLocaleData{"en": {Path: "/", Subtitle: "sous-titre [test](test)"}}}, "<p>sous-titre <a href=\"test\">test</a></p>\n"},
 		{Siteinfo{}, ""},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.siteinfo.SubtitleHelper(&Page{}); got != tc.want {
+			if got := tc.siteinfo.SubtitleHelper(&Page{}, "en"); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -65,12 +68,12 @@ func TestSiteinfo_DescriptionHelper(t *testing.T) {
 		siteinfo Siteinfo
 		want     string
 	}{
-		{Siteinfo{Description: "description [test](test)"}, "<p>description <a href=\"test\">test</a></p>\n"},
+		{Siteinfo{Locales: map[string]SiteinfoLocaleData{"en": {Path: "/", Description: "description [test](test)"}}}, "<p>description <a href=\"test\">test</a></p>\n"},
 		{Siteinfo{}, ""},
 	}
 	for tci, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
-			if got := tc.siteinfo.DescriptionHelper(&Page{}); got != tc.want {
+			if got := tc.siteinfo.DescriptionHelper(&Page{}, "en"); got != tc.want {
 				t.Errorf("got %s; want %s", got, tc.want)
 			}
 		})
@@ -93,11 +96,120 @@ func TestSiteinfo_FindAuthor(t *testing.T) {
 		t.Run(fmt.Sprintf("%d", ti), func(t *testing.T) {
 			if got, err := tc.siteinfo.FindAuthor(tc.name); !tc.shouldFail && err != nil || tc.shouldFail && err == nil || reflect.DeepEqual(got, tc.want) == false {
 				if tc.shouldFail {
-					t.Errorf("got %s, %s; want %s, a non-nil error", got, err, tc.want)
+					t.Errorf("got %v, %v; want %v, a non-nil error", got, err, tc.want)
 				} else {
-					t.Errorf("got %s, %s; want %s, nil", got, err, tc.want)
+					t.Errorf("got %v, %v; want %v, nil", got, err, tc.want)
 				}
 			}
 		})
 	}
 }
+
+func TestSiteinfo_PermalinkHelper(t *testing.T) {
+	cat := &Category{Locales: map[string]*CategoryLocaleData{"en": {Basename: ""}, "fr": {Basename: ""}}}
+	blog := &Category{Parent: cat, Locales: map[string]*CategoryLocaleData{"en": {Basename: "blog"}, "fr": {Basename: "blogue"}}}
+	testCases := []struct {
+		siteinfo  Siteinfo
+		page      *Page
+		locale    string
+		want      string
+		canonical string
+	}{
+		{Siteinfo{Locales: map[string]SiteinfoLocaleData{"en": {Path: "/"}}}, &Page{Category: blog, Basename: "post", Locale: "en"}, "en", "", ""},
+		{Siteinfo{BaseURL: "https://example.com/", Locales: map[string]SiteinfoLocaleData{"en": {Path: "/"}}}, &Page{Category: blog, Basename: "post", Locale: "en"}, "en", "https://example.com/blog/post.html", "<link rel=\"canonical\" href=\"https://example.com/blog/post.html\">"},
+		{Siteinfo{BaseURL: "https://example.com/site", Locales: map[string]SiteinfoLocaleData{"fr": {Path: "/fr"}}}, &Page{Category: blog, Basename: "index", Locale: "fr"}, "fr", "https://example.com/site/fr/blogue/index.html", "<link rel=\"canonical\" href=\"https://example.com/site/fr/blogue/index.html\">"},
+		{Siteinfo{BaseURL: "https://example.com", Locales: map[string]SiteinfoLocaleData{"fr": {Path: "/fr", BaseURL: "https://example.fr"}}}, &Page{Category: cat, Basename: "a", Locale: "fr"}, "fr", "https://example.fr/fr/a.html", "<link rel=\"canonical\" href=\"https://example.fr/fr/a.html\">"},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if got := tc.siteinfo.PermalinkHelper(tc.page, tc.locale); got != tc.want {
+				t.Errorf("got %s; want %s", got, tc.want)
+			}
+			if got := tc.siteinfo.CanonicalHelper(tc.page, tc.locale); got != tc.canonical {
+				t.Errorf("got %s; want %s", got, tc.canonical)
+			}
+		})
+	}
+}
+
+func TestCheckBaseURL(t *testing.T) {
+	testCases := []struct {
+		baseURL string
+		isErr   bool
+	}{
+		{"", false},
+		{"https://example.com", false},
+		{"http://example.com/blog/", false},
+		{"example.com", true},
+		{"/blog", true},
+		{"ftp://example.com", true},
+		{"https://example.com/?a=b", true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			if err := checkBaseURL(tc.baseURL); (err != nil) != tc.isErr {
+				t.Errorf("got err = %v; want error: %v", err, tc.isErr)
+			}
+		})
+	}
+}
+
+func TestLoadSiteinfo_authors(t *testing.T) {
+	testCases := []struct {
+		authors string
+		slugs   []string
+		isErr   bool
+	}{
+		{`[]`, nil, false},
+		{`[{"name": "Jane Doe"}, {"name": "John", "slug": "jd"}]`, []string{"jane-doe", "jd"}, false},
+		{`[{"name": "Jane Doe"}, {"name": "John", "slug": "jane-doe"}]`, nil, true},
+		{`[{"name": "???"}]`, nil, true},
+		{`[{"name": "A", "slug": "../a"}]`, nil, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			fsys := fstest.MapFS{"siteinfo.json": {Data: []byte(`{"locales": {"en": {"path": "/"}}, "authors": ` + tc.authors + `}`)}}
+			siteinfo, err := LoadSiteinfo(fsys, "siteinfo.json")
+			if (err != nil) != tc.isErr {
+				t.Fatalf("got err = %v; want error: %v", err, tc.isErr)
+			}
+			if tc.isErr {
+				return
+			}
+			var slugs []string
+			for _, author := range siteinfo.Authors {
+				slugs = append(slugs, author.Slug)
+			}
+			if !reflect.DeepEqual(slugs, tc.slugs) {
+				t.Errorf("got slugs %v; want %v", slugs, tc.slugs)
+			}
+		})
+	}
+}
+
+func TestLoadSiteinfo_timezone(t *testing.T) {
+	testCases := []struct {
+		timezone string
+		want     *time.Location
+		isErr    bool
+	}{
+		{``, time.UTC, false},
+		{`"UTC"`, time.UTC, false},
+		{`"Mars/Olympus_Mons"`, nil, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			data := `{"locales": {"en": {"path": "/"}}}`
+			if tc.timezone != "" {
+				data = `{"locales": {"en": {"path": "/"}}, "timezone": ` + tc.timezone + `}`
+			}
+			siteinfo, err := LoadSiteinfo(fstest.MapFS{"siteinfo.json": {Data: []byte(data)}}, "siteinfo.json")
+			if (err != nil) != tc.isErr {
+				t.Fatalf("got err = %v; want error: %v", err, tc.isErr)
+			}
+			if !tc.isErr && siteinfo.location().String() != tc.want.String() {
+				t.Errorf("got %v; want %v", siteinfo.location(), tc.want)
+			}
+		})
+	}
+}
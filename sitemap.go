@@ -0,0 +1,182 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+)
+
+// SitemapName is the name of the sitemap, at the root of the output.
+// When there are too many URLs for a single file, it is a sitemap index of files named sitemap-1.xml, sitemap-2.xml…
+// each listing the pages of a single locale.
+const SitemapName = "sitemap.xml"
+
+// maxSitemapURLs is the maximum number of URLs in a sitemap file.
+var maxSitemapURLs = 50000
+
+// SitemapConfig is the `sitemap` object of siteinfo.json.
+// If Unlisted is set, unlisted pages and categories are in the sitemap too. Drafts and untranslated pages never are.
+// The sitemap is generated only if the base URL of the website is known, since it needs absolute URLs.
+type SitemapConfig struct {
+	Unlisted bool `json:"unlisted"`
+}
+
+// isListed tells whether a page shows up in the website: neither it nor its categories are unlisted.
+// Index pages of categories are listed as long as their category is.
+func (page *Page) isListed(locale string) bool {
+	if page.Unlisted && !page.IsIndex() {
+		return false
+	}
+	for cat := page.Category; cat != nil; cat = cat.Parent {
+		if cat.Locales[locale].Unlisted {
+			return false
+		}
+	}
+	return true
+}
+
+// sitemapURL is a URL of a sitemap, with the versions of the page in other locales.
+type sitemapURL struct {
+	Loc        string        `xml:"loc"`
+	LastMod    string        `xml:"lastmod,omitempty"`
+	Alternates []sitemapLink `xml:"xhtml:link"`
+}
+
+type sitemapLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+// sitemapURLSet is the XML document of a sitemap.
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	XHTMLNS string       `xml:"xmlns:xhtml,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapIndex is the XML document of a sitemap index.
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod,omitempty"`
+	} `xml:"sitemap"`
+}
+
+// generateSitemap writes the sitemap of the pages of the given locales to out, and returns the number of URLs in it.
+func generateSitemap(s *Site, out Output, locales []string, cache *buildCache) (n int, err error) {
+	known := false
+	for _, locale := range locales {
+		known = known || s.Siteinfo.baseURL(locale) != ""
+	}
+	if !known {
+		return 0, nil
+	}
+
+	urls := sitemapURLs(&s.Siteinfo, s.Tree, locales, locales)
+
+	// a single sitemap
+	key := cache.siteKey(SitemapName, locales)
+	if len(urls) <= maxSitemapURLs {
+		return len(urls), writeSitemapPart(out, cache, SitemapName, key, urls)
+	}
+
+	// a sitemap index, with the URLs of each locale in their own parts, on the host of the locale
+	var index sitemapIndex
+	for _, locale := range locales {
+		localeURLs := sitemapURLs(&s.Siteinfo, s.Tree, []string{locale}, locales)
+		for i := 0; i*maxSitemapURLs < len(localeURLs); i++ {
+			part := localeURLs[i*maxSitemapURLs:]
+			if len(part) > maxSitemapURLs {
+				part = part[:maxSitemapURLs]
+			}
+			name := fmt.Sprintf("sitemap-%d.xml", len(index.Sitemaps)+1)
+			if err := writeSitemapPart(out, cache, name, key, part); err != nil {
+				return 0, err
+			}
+
+			entry := struct {
+				Loc     string `xml:"loc"`
+				LastMod string `xml:"lastmod,omitempty"`
+			}{Loc: s.Siteinfo.baseURL(locale) + "/" + name}
+			for _, u := range part {
+				if u.LastMod > entry.LastMod {
+					entry.LastMod = u.LastMod
+				}
+			}
+			index.Sitemaps = append(index.Sitemaps, entry)
+		}
+	}
+	if kept, err := cache.keep(SitemapName, key); kept || err != nil {
+		return len(urls), err
+	}
+	data, err := marshalXML(index)
+	if err != nil {
+		return 0, err
+	}
+	return len(urls), writeFile(out, SitemapName, data)
+}
+
+// writeSitemapPart writes a sitemap, or a part of a sitemap index, unless the cache already has it.
+// The key of the index covers its parts, since they are all made from the same pages.
+func writeSitemapPart(out Output, cache *buildCache, name, key string, urls []sitemapURL) error {
+	if kept, err := cache.keep(name, key); kept || err != nil {
+		return err
+	}
+	data, err := marshalXML(sitemapURLSet{XHTMLNS: "http://www.w3.org/1999/xhtml", URLs: urls})
+	if err != nil {
+		return err
+	}
+	return writeFile(out, name, data)
+}
+
+// sitemapURLs lists the URLs of the pages of pageLocales, sorted, with their versions in the other locales as alternates.
+func sitemapURLs(siteinfo *Siteinfo, tree *Category, pageLocales, locales []string) []sitemapURL {
+	var urls []sitemapURL
+	for _, locale := range pageLocales {
+		if siteinfo.baseURL(locale) == "" {
+			continue
+		}
+		for _, page := range individualPages(tree, locale) {
+			if page.Draft || page.Untranslated || !siteinfo.Sitemap.Unlisted && !page.isListed(locale) {
+				continue
+			}
+			u := sitemapURL{Loc: siteinfo.PermalinkHelper(page, locale), LastMod: pageLastMod(page, locale)}
+
+			// versions of the page in the other locales
+			for _, locale2 := range locales {
+				translation := page.inLocale(locale2)
+				if translation == nil || translation.Untranslated || siteinfo.baseURL(locale2) == "" {
+					continue
+				}
+				u.Alternates = append(u.Alternates, sitemapLink{
+					Rel:      "alternate",
+					Hreflang: locale2,
+					Href:     siteinfo.PermalinkHelper(translation, locale2),
+				})
+			}
+			if len(u.Alternates) == 1 {
+				u.Alternates = nil
+			}
+			urls = append(urls, u)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].Loc < urls[j].Loc })
+	return urls
+}
+
+// pageLastMod returns the date of a page, or for index pages without a date, that of the most recent page they list.
+func pageLastMod(page *Page, locale string) string {
+	date := page.lastModified()
+	if date.IsZero() && page.IsIndex() {
+		if recent := page.Category.RecentPages(1, locale); len(recent) > 0 {
+			date = recent[0].lastModified()
+		}
+	}
+	return formatDate(nil, locale, date, "2006-01-02")
+}
@@ -0,0 +1,187 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func sitemapTestInput(sitemap string) fstest.MapFS {
+	return fstest.MapFS{
+		"siteinfo.json":             {Data: []byte(`{"baseURL": "https://example.com", "sitemap": ` + sitemap + `, "locales": {"en": {"path": "/"}, "fr": {"path": "/fr"}}, "authors": [{"name": "A"}]}`)},
+		"pages/catinfo.json":        {Data: []byte(`{"name": "Home"}`)},
+		"pages/a.en.md":             {Data: []byte("---\ndate: 2018-01-01\ntags: t\n---\n# A")},
+		"pages/a.fr.md":             {Data: []byte("---\ndate: 2018-01-02\n---\n# A")},
+		"pages/blog/catinfo.json":   {Data: []byte(`{"name": "Blog"}`)},
+		"pages/blog/b.en.md":        {Data: []byte("---\ndate: 2018-02-01\n---\n# B")},
+		"pages/hidden/catinfo.json": {Data: []byte(`{"name": "Hidden", "unlisted": true}`)},
+		"pages/hidden/c.en.md":      {Data: []byte("---\ndate: 2018-03-01\n---\n# C")},
+		"templates/page.html":       {Data: []byte(`{{ define "Header" }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml":  {Data: []byte("en:\n    categories:\n        page_list_name: \"{{$1}}\"\n")},
+	}
+}
+
+type testSitemap struct {
+	URLs []struct {
+		Loc        string `xml:"loc"`
+		LastMod    string `xml:"lastmod"`
+		Alternates []struct {
+			Hreflang string `xml:"hreflang,attr"`
+			Href     string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"url"`
+}
+
+func (s testSitemap) locs() (locs []string) {
+	for _, u := range s.URLs {
+		locs = append(locs, u.Loc)
+	}
+	return locs
+}
+
+func TestGenerateSitemap(t *testing.T) {
+	testCases := []struct {
+		sitemap string
+		locs    []string
+	}{
+		{`{}`, []string{
+			"https://example.com/a.html",
+			"https://example.com/blog/b.html",
+			"https://example.com/blog/index.html",
+			"https://example.com/fr/a.html",
+			"https://example.com/fr/index.html",
+			"https://example.com/index.html",
+		}},
+		{`{"unlisted": true}`, []string{
+			"https://example.com/a.html",
+			"https://example.com/archive/2018/01/index.html",
+			"https://example.com/archive/2018/02/index.html",
+			"https://example.com/archive/2018/index.html",
+			"https://example.com/archive/index.html",
+			"https://example.com/author/a/index.html",
+			"https://example.com/author/index.html",
+			"https://example.com/blog/b.html",
+			"https://example.com/blog/index.html",
+			"https://example.com/fr/a.html",
+			"https://example.com/fr/archive/2018/01/index.html",
+			"https://example.com/fr/archive/2018/02/index.html",
+			"https://example.com/fr/archive/2018/index.html",
+			"https://example.com/fr/archive/index.html",
+			"https://example.com/fr/author/a/index.html",
+			"https://example.com/fr/author/index.html",
+			"https://example.com/fr/index.html",
+			"https://example.com/fr/tag/index.html",
+			"https://example.com/fr/tag/t/index.html",
+			"https://example.com/hidden/c.html",
+			"https://example.com/hidden/index.html",
+			"https://example.com/index.html",
+			"https://example.com/tag/index.html",
+			"https://example.com/tag/t/index.html",
+		}},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			out := NewMapOutput()
+			if _, err := Build(context.Background(), Options{FS: sitemapTestInput(tc.sitemap), Output: out}); err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			var sitemap testSitemap
+			if err := xml.Unmarshal(out.Files()[SitemapName], &sitemap); err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			if got := sitemap.locs(); !reflect.DeepEqual(got, tc.locs) {
+				t.Errorf("got %v; want %v", got, tc.locs)
+			}
+
+			// a.html is translated, with its own date
+			for _, u := range sitemap.URLs {
+				switch u.Loc {
+				case "https://example.com/a.html":
+					if u.LastMod != "2018-01-01" || len(u.Alternates) != 2 || u.Alternates[1].Href != "https://example.com/fr/a.html" || u.Alternates[1].Hreflang != "fr" {
+						t.Errorf("got %+v; want the fr version as alternate", u)
+					}
+				case "https://example.com/blog/index.html":
+					if u.LastMod != "2018-02-01" || len(u.Alternates) != 0 {
+						t.Errorf("got %+v; want the date of b.html and no alternates", u)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateSitemap_index(t *testing.T) {
+	defer func(max int) { maxSitemapURLs = max }(maxSitemapURLs)
+	maxSitemapURLs = 4
+
+	// the French version is on its own host
+	input := sitemapTestInput(`{}`)
+	input["siteinfo.json"].Data = bytes.Replace(input["siteinfo.json"].Data, []byte(`"path": "/fr"`), []byte(`"path": "/fr", "baseURL": "https://example.fr"`), 1)
+	outputDir := filepath.Join(t.TempDir(), "out")
+	if _, err := Build(context.Background(), Options{FS: input, OutputDir: outputDir}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	var index struct {
+		Locs []string `xml:"sitemap>loc"`
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, SitemapName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(data, &index); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	if want := []string{"https://example.com/sitemap-1.xml", "https://example.fr/sitemap-2.xml"}; !reflect.DeepEqual(index.Locs, want) {
+		t.Errorf("got %v; want %v", index.Locs, want)
+	}
+
+	// each part lists the pages of a single locale, on the host of its locale
+	for _, tc := range []struct {
+		name, host string
+		n          int
+	}{{"sitemap-1.xml", "https://example.com/", 4}, {"sitemap-2.xml", "https://example.fr/", 2}} {
+		data, err := os.ReadFile(filepath.Join(outputDir, tc.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sitemap testSitemap
+		if err := xml.Unmarshal(data, &sitemap); err != nil {
+			t.Fatalf("%v: got err = %v; want nil", tc.name, err)
+		}
+		if len(sitemap.URLs) != tc.n {
+			t.Errorf("%v: got %v URLs; want %v", tc.name, len(sitemap.URLs), tc.n)
+		}
+		for _, loc := range sitemap.locs() {
+			if !strings.HasPrefix(loc, tc.host) {
+				t.Errorf("%v: got %v; want a URL on %v", tc.name, loc, tc.host)
+			}
+		}
+	}
+
+	// an unchanged build keeps the index and its parts
+	files := make(map[string]os.FileInfo)
+	for _, name := range []string{SitemapName, "sitemap-1.xml", "sitemap-2.xml"} {
+		if files[name], err = os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Build(context.Background(), Options{FS: input, OutputDir: outputDir}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	for name, before := range files {
+		if got, err := os.Stat(filepath.Join(outputDir, name)); err != nil || !os.SameFile(got, before) {
+			t.Errorf("%v: got a new file; want it reused", name)
+		}
+	}
+}
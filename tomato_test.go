@@ -0,0 +1,382 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "example_html")
+	res, err := Build(context.Background(), Options{InputDir: "example", OutputDir: outputDir})
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	if res.Pages["en"] == 0 || res.Pages["fr"] == 0 {
+		t.Errorf("got %v pages generated; want some in every locale", res.Pages)
+	}
+	for _, name := range []string{"index.html", "fr/index.html", "projects/tomato.html", "tag/golang/index.html", "media/img/cat.jpg", "assets/style.css"} {
+		if !FileExists(filepath.Join(outputDir, name)) {
+			t.Errorf("%v was not generated", name)
+		}
+	}
+}
+
+func TestBuild_inMemory(t *testing.T) {
+	input := fstest.MapFS{
+		"siteinfo.json":            {Data: []byte(`{"locales": {"en": {"path": "/", "title": "Test"}}, "authors": [{"name": "A"}]}`)},
+		"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+		"pages/index.en.md":        {Data: []byte("#!author: A\n#!date: 2018-01-01\n\n# Hello\nworld")},
+		"pages/blog/catinfo.json":  {Data: []byte(`{"name": "Blog", "footer": "blog footer"}`)},
+		"pages/blog/post.en.md":    {Data: []byte("---\nauthor: A\ndate: 2018-01-02\ntags: t\nsubtitle: Sub\n---\n# Post\ncontent")},
+		"templates/page.html":      {Data: []byte(`{{ define "Header" }}<h1>{{ .Page.Title }}</h1>{{ with .Page.Params.subtitle }}<h2>{{ . }}</h2>{{ end }}{{ end }}{{ define "Footer" }}<footer>{{ .Locale }}{{ with .Page.Params.footer }} {{ . }}{{ end }}</footer>{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml": {Data: []byte("en:\n    categories:\n        page_list_name: \"Category: {{$1}}\"\n")},
+		"assets/style.css":         {Data: []byte("body {}")},
+	}
+	out := NewMapOutput()
+	if _, err := Build(context.Background(), Options{FS: input, Output: out}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+
+	want := []string{"archive/2018/01/index.html", "archive/2018/index.html", "archive/index.html", "assets/style.css", "author/a/index.html", "author/index.html", "blog/index.html", "blog/post.html", "index.html", "search.json", "tag/index.html", "tag/t/index.html"}
+	if got := out.Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got files %v; want %v", got, want)
+	}
+	if got, want := string(out.Files()["blog/post.html"]), "<h1>Post</h1><h2>Sub</h2><h1>Post</h1>\n\n<p>content</p>\n<footer>en blog footer</footer>"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestBuild_noAuthors(t *testing.T) {
+	input := fstest.MapFS{
+		"siteinfo.json":            {Data: []byte(`{"locales": {"en": {"path": "/"}}}`)},
+		"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+		"pages/blog/catinfo.json":  {Data: []byte(`{"name": "Blog"}`)},
+		"pages/blog/post.en.md":    {Data: []byte("# Post")},
+		"templates/page.html":      {Data: []byte(`{{ define "Header" }}[{{ .Siteinfo.MainAuthorHelper }}]{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml": {Data: []byte("en:\n    categories:\n        page_list_name: \"{{$1}}\"\n")},
+	}
+	out := NewMapOutput()
+	if _, err := Build(context.Background(), Options{FS: input, Output: out}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	want := []string{"blog/index.html", "blog/post.html", "index.html", "search.json", "tag/index.html"}
+	if got := out.Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got files %v; want %v", got, want)
+	}
+	if got := string(out.Files()["blog/index.html"]); !strings.HasPrefix(got, "[]") {
+		t.Errorf("got %q; want no main author", got)
+	}
+}
+
+func TestBuild_incremental(t *testing.T) {
+	// a paragraph longer than excerpts
+	longText := strings.Repeat("lorem ipsum ", 30)
+	input := fstest.MapFS{
+		"siteinfo.json":            {Data: []byte(`{"locales": {"en": {"path": "/", "title": "Test"}}, "authors": [{"name": "A"}]}`)},
+		"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+		"pages/index.en.md":        {Data: []byte("#!author: A\n#!date: 2018-01-01\n\n# Hello\nworld")},
+		"pages/about.en.md":        {Data: []byte("#!author: A\n#!date: 2018-01-01\n\n# About\nme")},
+		"pages/blog/catinfo.json":  {Data: []byte(`{"name": "Blog"}`)},
+		"pages/blog/post.en.md":    {Data: []byte("#!author: A\n#!date: 2018-01-02\n#!tags: t\n\n# Post\ncontent\n\n" + longText + "\n\nend")},
+		"templates/page.html":      {Data: []byte(`{{ define "Header" }}<h1>{{ .Page.Title }}</h1>{{ range .Tree.RecentPages 5 .Locale }}[{{ .Excerpt }}]{{ end }}{{ end }}{{ define "Footer" }}<footer>{{ .Locale }}</footer>{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml": {Data: []byte("en:\n    categories:\n        page_list_name: \"Category: {{$1}}\"\n")},
+		"assets/style.css":         {Data: []byte("body {}")},
+		"media/a.png":              {Data: []byte("aaa"), ModTime: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	outputDir := filepath.Join(t.TempDir(), "out")
+	build := func(opts Options) *Result {
+		t.Helper()
+		opts.FS, opts.OutputDir = input, outputDir
+		res, err := Build(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("got err = %v; want nil", err)
+		}
+		return res
+	}
+
+	if res := build(Options{}); res.Reused != 0 {
+		t.Errorf("first build: got %v reused files; want 0", res.Reused)
+	}
+	if res := build(Options{}); res.Reused != 14 {
+		t.Errorf("unchanged build: got %v reused files; want 14", res.Reused)
+	}
+	if res := build(Options{Clean: true}); res.Reused != 0 {
+		t.Errorf("clean build: got %v reused files; want 0", res.Reused)
+	}
+
+	// changing the end of the post changes the post and the index pages listing it, but not the other pages
+	input["pages/blog/post.en.md"] = &fstest.MapFile{Data: []byte("#!author: A\n#!date: 2018-01-02\n#!tags: t\n\n# Post\ncontent\n\n" + longText + "\n\nnew end")}
+	about, err := os.Stat(filepath.Join(outputDir, "about.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := build(Options{}); res.Reused != 3 {
+		t.Errorf("changed content: got %v reused files; want 3", res.Reused)
+	}
+	if got, err := os.Stat(filepath.Join(outputDir, "about.html")); err != nil || !os.SameFile(got, about) {
+		t.Errorf("changed content: got about.html rewritten, %v; want it reused", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "blog", "post.html")); err != nil || !strings.Contains(string(got), "new end") {
+		t.Errorf("changed content: got post %q, %v", got, err)
+	}
+
+	// changing its excerpt changes every page, since any of them can list it with RecentPages
+	input["pages/blog/post.en.md"] = &fstest.MapFile{Data: []byte("#!author: A\n#!date: 2018-01-02\n#!tags: t\n\n# Post\nnew content\n\n" + longText + "\n\nnew end")}
+	if res := build(Options{}); res.Reused != 2 {
+		t.Errorf("changed excerpt: got %v reused files; want 2", res.Reused)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "about.html")); err != nil || !strings.Contains(string(got), "new content") {
+		t.Errorf("changed excerpt: got about %q, %v", got, err)
+	}
+
+	// media are copied again when their content changes, even with the same size and modification time
+	input["media/a.png"] = &fstest.MapFile{Data: []byte("bbb"), ModTime: input["media/a.png"].ModTime}
+	if res := build(Options{}); res.Reused != 13 {
+		t.Errorf("changed media: got %v reused files; want 13", res.Reused)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "media", "a.png")); err != nil || string(got) != "bbb" {
+		t.Errorf("changed media: got %q, %v; want bbb", got, err)
+	}
+
+	// deleting a page changes the navigation of all pages, and removes it from the output
+	delete(input, "pages/about.en.md")
+	if res := build(Options{}); res.Reused != 2 {
+		t.Errorf("deleted page: got %v reused files; want 2", res.Reused)
+	}
+	if FileExists(filepath.Join(outputDir, "about.html")) {
+		t.Errorf("deleted page: about.html still exists")
+	}
+
+	// the result is the same as a clean build
+	clean := NewMapOutput()
+	if _, err := Build(context.Background(), Options{FS: input, Output: clean}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	for name, want := range clean.Files() {
+		if got, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(name))); err != nil || string(got) != string(want) {
+			t.Errorf("%v: got %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestBuild_jobs(t *testing.T) {
+	site, err := LoadSite(context.Background(), Options{InputDir: "example"})
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	serial := NewMapOutput()
+	if _, err := site.Generate(context.Background(), Options{FS: site.FS, Output: serial, Jobs: 1}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	parallel := NewMapOutput()
+	if _, err := site.Generate(context.Background(), Options{FS: site.FS, Output: parallel, Jobs: 8}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	if !reflect.DeepEqual(serial.Files(), parallel.Files()) {
+		t.Errorf("parallel build differs from serial build")
+	}
+}
+
+func TestLoadSite(t *testing.T) {
+	testCases := []struct {
+		opts Options
+		err  bool
+	}{
+		{Options{InputDir: "example"}, false},
+		{Options{InputDir: "example", Locales: []string{"fr"}}, false},
+		{Options{InputDir: "example", Locales: []string{"de"}}, true},
+		{Options{InputDir: "does-not-exist"}, true},
+		{Options{InputDir: "example", ConfigPath: "does-not-exist.json"}, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			site, err := LoadSite(context.Background(), tc.opts)
+			if (err != nil) != tc.err {
+				t.Fatalf("got err = %v; want %v", err, tc.err)
+			}
+			if err == nil && site.Tree.PageCount("en") == 0 {
+				t.Errorf("got no pages in the tree")
+			}
+		})
+	}
+}
+
+func TestLoadSite_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := LoadSite(ctx, Options{InputDir: "example"}); err != context.Canceled {
+		t.Errorf("got err = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestBuild_drafts(t *testing.T) {
+	input := fstest.MapFS{
+		"siteinfo.json":            {Data: []byte(`{"baseURL": "https://example.com", "locales": {"en": {"path": "/"}, "fr": {"path": "/fr"}}}`)},
+		"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+		"pages/post.en.md":         {Data: []byte("---\ndate: 2018-01-01\n---\n# Post")},
+		"pages/post.fr.md":         {Data: []byte("---\ndate: 2018-01-01\ndraft: true\n---\n# Billet")},
+		"pages/draft.en.md":        {Data: []byte("---\ndate: 2018-01-02\ndraft: true\n---\n# Draft")},
+		"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ if .Page.Draft }}DRAFT {{ end }}[{{ .Page.PathInLocale "fr" }}]{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ range .Page.Pager.Pages }}{{ .Path }} {{ end }}{{ end }}`)},
+		"templates/locales/en.yml": {Data: []byte("en:\n    locale_name: English\n")},
+		"templates/locales/fr.yml": {Data: []byte("fr:\n    locale_name: Français\n")},
+	}
+	draft, billet := draftBasename("draft", "s", "pages/draft.en.md")+".html", draftBasename("post", "s", "pages/post.fr.md")+".html"
+	testCases := []struct {
+		drafts     bool
+		secret     string
+		wantDraft  string
+		wantPost   string
+		wantListed bool
+	}{
+		{false, "", "", "[]", false},
+		{true, "", "draft.html", "[/post.html]", true},
+		{false, "s", draft, "[]", false},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			out := NewMapOutput()
+			if _, err := Build(context.Background(), Options{FS: input, Output: out, Drafts: tc.drafts, DraftSecret: tc.secret}); err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			files := out.Files()
+			if tc.wantDraft != "" && !strings.HasPrefix(string(files[tc.wantDraft]), "DRAFT ") {
+				t.Errorf("got %v = %q; want a draft", tc.wantDraft, files[tc.wantDraft])
+			}
+			if _, ok := files["draft.html"]; ok != (tc.wantDraft == "draft.html") {
+				t.Errorf("got draft.html generated = %v; want %v", ok, !ok)
+			}
+			if got := string(files["post.html"]); !strings.HasPrefix(got, tc.wantPost) {
+				t.Errorf("got post.html = %q; want a link to the French version %v", got, tc.wantPost)
+			}
+			if tc.secret != "" && !strings.HasPrefix(string(files["fr/"+billet]), "DRAFT [/"+billet+"]") {
+				t.Errorf("got %v = %q; want a draft at a secret URL; got files %v", billet, files["fr/"+billet], out.Names())
+			}
+			if got := strings.Contains(string(files["index.html"]), "draft"); got != tc.wantListed {
+				t.Errorf("got draft listed = %v; want %v", got, tc.wantListed)
+			}
+			for _, name := range []string{"feed.xml", "atom.xml", "feed.json", "sitemap.xml", "search.json"} {
+				if strings.Contains(string(files[name]), "draft") {
+					t.Errorf("%v: got %q; want no drafts", name, files[name])
+				}
+			}
+		})
+	}
+}
+
+func TestBuild_fallback(t *testing.T) {
+	input := func(fallback, blog string) fstest.MapFS {
+		return fstest.MapFS{
+			"siteinfo.json":            {Data: []byte(`{"baseURL": "https://example.com", "locales": {"en": {"path": "/"}, "fr": {"path": "/fr"}}` + fallback + `}`)},
+			"pages/catinfo.json":       {Data: []byte(`{"name": "Home"}`)},
+			"pages/index.en.md":        {Data: []byte("# Home")},
+			"pages/index.fr.md":        {Data: []byte("# Accueil")},
+			"pages/00.post.en.md":      {Data: []byte("---\ndate: 2018-01-01\n---\n# Post")},
+			"pages/01.billet.fr.md":    {Data: []byte("---\ndate: 2018-01-01\n---\n# Billet")},
+			"pages/blog/catinfo.json":  {Data: []byte(blog)},
+			"pages/blog/a.en.md":       {Data: []byte("---\ndate: 2018-01-01\n---\n# A")},
+			"templates/page.html":      {Data: []byte(`{{ define "Header" }}{{ if .Page.Untranslated }}UNTRANSLATED {{ .Page.Original.Locale }} {{ end }}[{{ .Page.PathInLocale "fr" }}]{{ .Siteinfo.CanonicalHelper .Page .Locale }}{{ .Siteinfo.AlternatesHelper .Page .Locale }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+			"templates/locales/en.yml": {Data: []byte("en:\n    locale_name: English\n")},
+			"templates/locales/fr.yml": {Data: []byte("fr:\n    locale_name: Français\n")},
+		}
+	}
+	testCases := []struct {
+		fallback, blog string
+		wantPost       bool
+		wantBlog       bool
+	}{
+		{"", `{"name": "Blog"}`, false, false},
+		{`, "fallback": true`, `{"name": "Blog"}`, true, true},
+		{`, "fallback": true`, `{"en": {"name": "Blog"}, "fr": {"name": "Blog", "fallback": false}}`, true, false},
+		{"", `{"en": {"name": "Blog"}, "fr": {"name": "Blog", "fallback": true}}`, false, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			out := NewMapOutput()
+			if _, err := Build(context.Background(), Options{FS: input(tc.fallback, tc.blog), Output: out}); err != nil {
+				t.Fatalf("got err = %v; want nil", err)
+			}
+			files := out.Files()
+			want := "UNTRANSLATED en [/post.html]<link rel=\"canonical\" href=\"https://example.com/post.html\">"
+			if got := string(files["fr/post.html"]); tc.wantPost && !strings.HasPrefix(got, want) {
+				t.Errorf("got fr/post.html = %q; want %q", got, want)
+			}
+			if _, ok := files["fr/post.html"]; ok != tc.wantPost {
+				t.Errorf("got fr/post.html generated = %v; want %v", ok, tc.wantPost)
+			}
+			if _, ok := files["fr/blog/a.html"]; ok != tc.wantBlog {
+				t.Errorf("got fr/blog/a.html generated = %v; want %v", ok, tc.wantBlog)
+			}
+			if _, ok := files["billet.html"]; ok {
+				t.Errorf("got billet.html generated; want only the default locale to be a fallback")
+			}
+			if got := string(files["post.html"]); tc.wantPost != strings.HasPrefix(got, "[/post.html]") || strings.Contains(got, "hreflang") {
+				t.Errorf("got post.html = %q; want a link to the French version = %v, and no alternates", got, tc.wantPost)
+			}
+			if got := string(files["index.html"]); !strings.Contains(got, `<link rel="alternate" hreflang="fr" href="https://example.com/fr/index.html">`) {
+				t.Errorf("got index.html = %q; want the French version as alternate", got)
+			}
+			for _, name := range []string{"fr/feed.xml", "fr/atom.xml", "fr/feed.json", "sitemap.xml", "fr/search.json"} {
+				if strings.Contains(string(files[name]), "fr/post.html") || strings.Contains(string(files[name]), "fr/blog/a.html") {
+					t.Errorf("%v: got %q; want no untranslated pages", name, files[name])
+				}
+			}
+		})
+	}
+}
+
+func TestBuild_unlisted(t *testing.T) {
+	input := func(sitemap string) fstest.MapFS {
+		return fstest.MapFS{
+			"siteinfo.json":             {Data: []byte(`{"baseURL": "https://example.com", "locales": {"en": {"path": "/"}}` + sitemap + `}`)},
+			"pages/catinfo.json":        {Data: []byte(`{"name": "Home"}`)},
+			"pages/post.en.md":          {Data: []byte("---\ndate: 2018-01-01\ntags: blog\n---\n# Post")},
+			"pages/legal.en.md":         {Data: []byte("---\ndate: 2018-01-02\ntags: legal\nunlisted: true\n---\n# Legal notice")},
+			"pages/about/catinfo.json":  {Data: []byte(`{"name": "About"}`)},
+			"pages/about/contact.en.md": {Data: []byte("---\nunlisted: true\n---\n# Contact")},
+			"templates/page.html":       {Data: []byte(`{{ define "Header" }}{{ .Tree.NavHelper .Page true .Locale "/" }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ range .Page.Pager.Pages }}{{ .Title }} {{ end }}{{ end }}`)},
+			"templates/locales/en.yml":  {Data: []byte("en:\n    locale_name: English\n")},
+		}
+	}
+	out := NewMapOutput()
+	if _, err := Build(context.Background(), Options{FS: input(""), Output: out}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	files := out.Files()
+	if !strings.Contains(string(files["legal.html"]), "<h1>Legal notice</h1>") {
+		t.Errorf("got legal.html = %q; want the page rendered", files["legal.html"])
+	}
+	if _, ok := files["tag/legal/index.html"]; ok {
+		t.Errorf("got tag/legal/index.html generated; want no tag for unlisted pages")
+	}
+	// a category holding only unlisted pages has no index page, but its pages are generated
+	if !strings.Contains(string(files["about/contact.html"]), "<h1>Contact</h1>") {
+		t.Errorf("got about/contact.html = %q; want the page rendered", files["about/contact.html"])
+	}
+	if _, ok := files["about/index.html"]; ok {
+		t.Errorf("got about/index.html generated; want no index page for a category without listed pages")
+	}
+	for _, name := range []string{"index.html", "post.html", "feed.xml", "sitemap.xml", "search.json"} {
+		if strings.Contains(string(files[name]), "egal") {
+			t.Errorf("%v: got %q; want the unlisted page left out", name, files[name])
+		}
+	}
+
+	out = NewMapOutput()
+	if _, err := Build(context.Background(), Options{FS: input(`, "sitemap": {"unlisted": true}`), Output: out}); err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	if got := string(out.Files()["sitemap.xml"]); !strings.Contains(got, "https://example.com/legal.html") {
+		t.Errorf("got sitemap.xml = %q; want the unlisted page", got)
+	}
+}
@@ -0,0 +1,375 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML decodes a TOML document, as used in front matter.
+// It supports key/value pairs with bare, quoted and dotted keys, tables, strings of all kinds, integers, floats,
+// booleans, arrays and inline tables. Dates and times, with or without seconds, are returned as strings,
+// to be parsed by the caller. Arrays of tables are not supported.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{src: string(data), line: 1}
+	root := make(map[string]interface{})
+	table := root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			// table header
+			p.pos++
+			if p.peek() == '[' {
+				return nil, p.errorf("arrays of tables are not supported, use an array of inline tables instead")
+			}
+			keys, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if !p.consume("]") {
+				return nil, p.errorf("expected ] after table name")
+			}
+			if table, err = p.table(root, keys); err != nil {
+				return nil, err
+			}
+		} else {
+			// key/value pair
+			keys, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if !p.consume("=") {
+				return nil, p.errorf("expected = after key")
+			}
+			p.skipSpace(false)
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			parent, err := p.table(table, keys[:len(keys)-1])
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := parent[keys[len(keys)-1]]; ok {
+				return nil, p.errorf("duplicate key %v", strings.Join(keys, "."))
+			}
+			parent[keys[len(keys)-1]] = value
+		}
+
+		// end of line
+		p.skipSpace(false)
+		if !p.eof() && !p.consume("\n") && !p.consume("\r\n") {
+			return nil, p.errorf("expected end of line, got %q", p.peek())
+		}
+		p.line++
+	}
+}
+
+// tomlParser reads a TOML document from src.
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+// errorf returns an error located at the current line.
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("toml: line %v: %v", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+// peek returns the next byte, or 0 at the end of the document.
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// consume skips s and returns true if it comes next.
+func (p *tomlParser) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// skipSpace skips spaces, tabs and comments, and also new lines if newlines is set.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case newlines && c == '\r' && strings.HasPrefix(p.src[p.pos:], "\r\n"):
+			p.pos += 2
+			p.line++
+		case newlines && c == '\n':
+			p.pos++
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+// table returns the table at keys under root, creating it if needed.
+func (p *tomlParser) table(root map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	table := root
+	for _, key := range keys {
+		switch sub := table[key].(type) {
+		case nil:
+			t := make(map[string]interface{})
+			table[key] = t
+			table = t
+		case map[string]interface{}:
+			table = sub
+		default:
+			return nil, p.errorf("%v is not a table", strings.Join(keys, "."))
+		}
+	}
+	return table, nil
+}
+
+var tomlBareKeyRE = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+
+// key reads a possibly dotted key and returns its parts.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		switch p.peek() {
+		case '"', '\'':
+			key, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		default:
+			key := tomlBareKeyRE.FindString(p.src[p.pos:])
+			if key == "" {
+				return nil, p.errorf("expected a key")
+			}
+			p.pos += len(key)
+			keys = append(keys, key)
+		}
+		p.skipSpace(false)
+		if !p.consume(".") {
+			return keys, nil
+		}
+	}
+}
+
+var (
+	tomlDateTimeRE = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})?)?|^\d{2}:\d{2}(:\d{2}(\.\d+)?)?`)
+	tomlNumberRE   = regexp.MustCompile(`^[+-]?[0-9A-Za-z_.+-]+`)
+)
+
+// value reads any value.
+func (p *tomlParser) value() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	case p.consume("true"):
+		return true, nil
+	case p.consume("false"):
+		return false, nil
+	}
+
+	if s := tomlDateTimeRE.FindString(p.src[p.pos:]); s != "" {
+		p.pos += len(s)
+		return s, nil
+	}
+	s := tomlNumberRE.FindString(p.src[p.pos:])
+	if s == "" {
+		return nil, p.errorf("expected a value")
+	}
+	p.pos += len(s)
+	s = strings.Replace(s, "_", "", -1)
+	if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %q", s)
+}
+
+// array reads an array, which may span several lines.
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	values := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.consume("]") {
+			return values, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipSpace(true)
+		if p.consume("]") {
+			return values, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// inlineTable reads an inline table, on a single line.
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++
+	table := make(map[string]interface{})
+	p.skipSpace(false)
+	if p.consume("}") {
+		return table, nil
+	}
+	for {
+		keys, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if !p.consume("=") {
+			return nil, p.errorf("expected = after key")
+		}
+		p.skipSpace(false)
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		parent, err := p.table(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, err
+		}
+		parent[keys[len(keys)-1]] = value
+		p.skipSpace(false)
+		if p.consume("}") {
+			return table, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or } in inline table")
+		}
+		p.skipSpace(false)
+	}
+}
+
+// str reads a basic or literal string, either on one line or multi-line.
+func (p *tomlParser) str() (string, error) {
+	quote := p.src[p.pos : p.pos+1]
+	multiline := p.consume(quote + quote + quote)
+	if multiline {
+		// a newline right after the opening delimiter is trimmed
+		if p.consume("\n") || p.consume("\r\n") {
+			p.line++
+		}
+	} else {
+		p.pos++
+	}
+
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if multiline && p.consume(quote+quote+quote) {
+			return sb.String(), nil
+		}
+		if !multiline && p.consume(quote) {
+			return sb.String(), nil
+		}
+
+		c := p.peek()
+		switch {
+		case c == '\n' && !multiline:
+			return "", p.errorf("unterminated string")
+		case c == '\\' && quote == `"`:
+			if err := p.escape(&sb, multiline); err != nil {
+				return "", err
+			}
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// escape reads an escape sequence of a basic string into sb.
+func (p *tomlParser) escape(sb *strings.Builder, multiline bool) error {
+	p.pos++
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid unicode escape")
+		}
+		sb.WriteRune(rune(r))
+		p.pos += n
+	default:
+		// line ending backslash in multi-line strings: trim the new line and following whitespace
+		if multiline && (c == '\n' || c == ' ' || c == '\t' || c == '\r') {
+			p.pos--
+			for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+				if p.peek() == '\n' {
+					p.line++
+				}
+				p.pos++
+			}
+			return nil
+		}
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
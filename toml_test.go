@@ -0,0 +1,50 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want map[string]interface{}
+		err  bool
+	}{
+		{"", map[string]interface{}{}, false},
+		{"# comment\n\na = \"b\" # comment\n", map[string]interface{}{"a": "b"}, false},
+		{`s = "tab\tquote\" \u00e9"`, map[string]interface{}{"s": "tab\tquote\" é"}, false},
+		{`s = 'C:\path'`, map[string]interface{}{"s": `C:\path`}, false},
+		{"s = \"\"\"\nline 1\nline 2\"\"\"", map[string]interface{}{"s": "line 1\nline 2"}, false},
+		{"i = 1_000\nf = 3.5\nh = 0xff\nb = true\nc = false", map[string]interface{}{"i": int64(1000), "f": 3.5, "h": int64(255), "b": true, "c": false}, false},
+		{"d = 2018-06-02\nt = 2018-06-02T10:00:00+02:00\nl = 1979-05-27 07:32:00", map[string]interface{}{"d": "2018-06-02", "t": "2018-06-02T10:00:00+02:00", "l": "1979-05-27 07:32:00"}, false},
+		{"d = 2018-06-02 10:00\nt = 07:32", map[string]interface{}{"d": "2018-06-02 10:00", "t": "07:32"}, false},
+		{"a = [\n  \"x\", # first\n  \"y\",\n]\ne = []", map[string]interface{}{"a": []interface{}{"x", "y"}, "e": []interface{}{}}, false},
+		{"a.b = 1\n\"c d\" = 2", map[string]interface{}{"a": map[string]interface{}{"b": int64(1)}, "c d": int64(2)}, false},
+		{"[params]\nx = 1\n[params.sub]\ny = 2", map[string]interface{}{"params": map[string]interface{}{"x": int64(1), "sub": map[string]interface{}{"y": int64(2)}}}, false},
+		{"p = { x = 1, y = \"z\" }", map[string]interface{}{"p": map[string]interface{}{"x": int64(1), "y": "z"}}, false},
+		{"a = 1\na = 2", nil, true},
+		{"a = ", nil, true},
+		{"a = \"unterminated", nil, true},
+		{"a = 1 b = 2", nil, true},
+		{"a = nope", nil, true},
+		{"[[tables]]", nil, true},
+		{"a = 1\na.b = 2", nil, true},
+	}
+	for tci, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tci), func(t *testing.T) {
+			got, err := parseTOML([]byte(tc.src))
+			if (err != nil) != tc.err {
+				t.Fatalf("got err = %v; want error: %v", err, tc.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v; want %#v", got, tc.want)
+			}
+		})
+	}
+}
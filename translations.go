@@ -0,0 +1,422 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TranslationStatus is the translation coverage of a locale of a website.
+// Pages, Categories and Strings count the pages, the categories and the template strings of the website in any locale.
+// MissingPages lists the source files of the pages with no version in the locale, or only a draft like the stubs,
+// MissingCategories the catinfo.json files without a name for the locale, and MissingStrings the keys
+// used by tomato or the templates, or defined for another locale, but not for this one.
+// Pages only written as drafts are not counted, and stubs files do not count as translations.
+type TranslationStatus struct {
+	Locale            string   `json:"locale"`
+	Pages             int      `json:"pages"`
+	MissingPages      []string `json:"missingPages"`
+	Categories        int      `json:"categories"`
+	MissingCategories []string `json:"missingCategories"`
+	Strings           int      `json:"strings"`
+	MissingStrings    []string `json:"missingStrings"`
+}
+
+// TranslationReport is the result of CheckTranslations: the status of each locale, sorted.
+// Stubs holds the files to write to the input, by path, to add the missing translations,
+// copied from the default locale when possible: drafts of the missing pages,
+// `catinfo.stubs.json` files next to the catinfo.json files, holding the missing locales to merge into them by hand,
+// and `templates/locales/<locale>.stubs.yml` files holding the missing strings.
+type TranslationReport struct {
+	Locales []TranslationStatus `json:"locales"`
+	Stubs   map[string][]byte   `json:"-"`
+}
+
+// StubsLocaleFile is the name of the locale file where the missing strings of a locale are written.
+// LoadLocales skips these files until their strings are merged into the locale file by hand.
+const StubsLocaleFile = "templates/locales/%v.stubs.yml"
+
+// builtinKeys are the keys of the locale files tomato translates itself, and not through the templates.
+var builtinKeys = []string{"archive.page_list_name", "authors.page_list_name", "categories.page_list_name", "tags.page_list_name"}
+
+// CheckTranslations loads the website of opts, drafts and future pages included, and reports what is not translated
+// to each of its locales.
+func CheckTranslations(ctx context.Context, opts Options) (*TranslationReport, error) {
+	opts.Drafts, opts.Future, opts.Log = true, true, nil
+	s, err := LoadSite(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var locales []string
+	for locale := range s.Siteinfo.Locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	defaultLocale := s.Siteinfo.defaultLocale()
+
+	report := &TranslationReport{Stubs: make(map[string][]byte)}
+	statuses := make(map[string]*TranslationStatus)
+	for _, locale := range locales {
+		statuses[locale] = &TranslationStatus{Locale: locale}
+	}
+	if err := s.checkPageTranslations(locales, defaultLocale, statuses, report.Stubs); err != nil {
+		return nil, err
+	}
+	if err := s.checkCategoryTranslations(locales, defaultLocale, statuses, report.Stubs); err != nil {
+		return nil, err
+	}
+	if err := s.checkStringTranslations(locales, defaultLocale, statuses, report.Stubs); err != nil {
+		return nil, err
+	}
+	for _, locale := range locales {
+		report.Locales = append(report.Locales, *statuses[locale])
+	}
+	return report, nil
+}
+
+// checkPageTranslations finds the pages missing from each locale, and writes drafts of them to stubs.
+func (s *Site) checkPageTranslations(locales []string, defaultLocale string, statuses map[string]*TranslationStatus, stubs map[string][]byte) error {
+	// the versions of a page in every locale are the pages of a category sharing an ID
+	type groupKey struct {
+		cat *Category
+		id  string
+	}
+	groups := make(map[groupKey]map[string]*Page)
+	var keys []groupKey
+	for _, locale := range locales {
+		for _, page := range individualPages(s.Tree, locale) {
+			if page.Source == "" || page.Untranslated {
+				continue
+			}
+			key := groupKey{page.Category, page.ID}
+			if groups[key] == nil {
+				groups[key] = make(map[string]*Page)
+				keys = append(keys, key)
+			}
+			groups[key][locale] = page
+		}
+	}
+
+	for _, key := range keys {
+		versions := groups[key]
+		original := versions[defaultLocale]
+		for _, locale := range locales {
+			if original != nil && !original.Draft {
+				break
+			}
+			original = versions[locale]
+		}
+		if original == nil || original.Draft {
+			// not published in any locale yet
+			continue
+		}
+		for _, locale := range locales {
+			statuses[locale].Pages++
+			if versions[locale] != nil && !versions[locale].Draft {
+				continue
+			}
+			statuses[locale].MissingPages = append(statuses[locale].MissingPages, original.Source)
+			if versions[locale] != nil {
+				// already stubbed
+				continue
+			}
+			name, stub, err := s.pageStub(original, locale)
+			if err != nil {
+				return err
+			}
+			stubs[name] = stub
+		}
+	}
+	for _, status := range statuses {
+		sort.Strings(status.MissingPages)
+	}
+	return nil
+}
+
+// pageStub returns the path and the content of a draft of a page for another locale, copied from the page.
+func (s *Site) pageStub(page *Page, locale string) (string, []byte, error) {
+	src, err := fs.ReadFile(s.FS, page.Source)
+	if err != nil {
+		return "", nil, err
+	}
+	fm, content, err := ParseFrontMatter(src)
+	if err != nil {
+		return "", nil, fmt.Errorf("%v: %v", page.Source, err)
+	}
+	fm.Draft = true
+	header, err := fm.YAML()
+	if err != nil {
+		return "", nil, fmt.Errorf("%v: %v", page.Source, err)
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(page.Source, ".md"), "."+page.Locale)
+	return name + "." + locale + ".md", append(append(header, '\n'), content...), nil
+}
+
+// checkCategoryTranslations finds the catinfo.json files without a name for each locale,
+// and writes the missing locales to a `catinfo.stubs.json` file next to them in stubs, copied from the default locale.
+// Like in LoadSite, a catinfo.json file holding a single name applies it to all locales, so it is never missing.
+func (s *Site) checkCategoryTranslations(locales []string, defaultLocale string, statuses map[string]*TranslationStatus, stubs map[string][]byte) error {
+	return WalkDir(s.FS, "pages", func(fpath string) error {
+		if path.Base(fpath) != "catinfo.json" {
+			return nil
+		}
+		content, err := fs.ReadFile(s.FS, fpath)
+		if err != nil {
+			return err
+		}
+		type localeName struct {
+			Name string `json:"name"`
+		}
+		for _, locale := range locales {
+			statuses[locale].Categories++
+		}
+		var single localeName
+		if json.Unmarshal(content, &single) == nil && single.Name != "" {
+			return nil
+		}
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(content, &data); err != nil {
+			return fmt.Errorf("%v: %v", fpath, err)
+		}
+
+		original := data[defaultLocale]
+		missing := make(map[string]json.RawMessage)
+		for _, locale := range locales {
+			var l localeName
+			if raw, ok := data[locale]; ok && json.Unmarshal(raw, &l) == nil && l.Name != "" {
+				if original == nil {
+					original = raw
+				}
+				continue
+			}
+			statuses[locale].MissingCategories = append(statuses[locale].MissingCategories, fpath)
+			missing[locale] = nil
+		}
+		if len(missing) == 0 || original == nil {
+			return nil
+		}
+		for locale := range missing {
+			missing[locale] = original
+		}
+		stub, err := json.MarshalIndent(missing, "", "\t")
+		if err != nil {
+			return fmt.Errorf("%v: %v", fpath, err)
+		}
+		stubs[path.Join(path.Dir(fpath), "catinfo.stubs.json")] = append(stub, '\n')
+		return nil
+	})
+}
+
+// checkStringTranslations finds the keys of the locale files missing for each locale,
+// and writes them to the StubsLocaleFile of the locale in stubs, copied from the default locale when possible.
+func (s *Site) checkStringTranslations(locales []string, defaultLocale string, statuses map[string]*TranslationStatus, stubs map[string][]byte) error {
+	paths, err := fs.Glob(s.FS, "templates/locales/*.yml")
+	if err != nil {
+		return err
+	}
+	defined := make(map[string]map[string]string)
+	stubsDefined := make(map[string]map[string]string)
+	for _, locale := range locales {
+		defined[locale] = make(map[string]string)
+		stubsDefined[locale] = make(map[string]string)
+	}
+	known := make(map[string]bool)
+	for _, key := range builtinKeys {
+		known[key] = true
+	}
+	for _, fpath := range paths {
+		translations, err := readLocaleFile(s.FS, fpath)
+		if err != nil {
+			return err
+		}
+		for _, t := range translations {
+			switch {
+			case defined[t.Locale] == nil:
+			case isStubsLocaleFile(fpath):
+				// kept when the stubs file is written again, but not a translation yet
+				if fpath == fmt.Sprintf(StubsLocaleFile, t.Locale) {
+					stubsDefined[t.Locale][t.Key] = t.Value
+				}
+			default:
+				defined[t.Locale][t.Key] = t.Value
+				known[t.Key] = true
+			}
+		}
+	}
+	for _, tmpl := range s.Templates.Templates() {
+		if tmpl.Tree != nil {
+			templateKeys(tmpl.Tree.Root, known)
+		}
+	}
+
+	var keys []string
+	for key := range known {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, locale := range locales {
+		status := statuses[locale]
+		status.Strings = len(keys)
+		for _, key := range keys {
+			if _, ok := defined[locale][key]; ok {
+				continue
+			}
+			status.MissingStrings = append(status.MissingStrings, key)
+			if _, ok := stubsDefined[locale][key]; ok {
+				// keep what was already written to the stubs file
+				continue
+			}
+			value, ok := defined[defaultLocale][key]
+			for _, l := range locales {
+				if ok {
+					break
+				}
+				value, ok = defined[l][key]
+			}
+			stubsDefined[locale][key] = value
+		}
+		if len(status.MissingStrings) > 0 {
+			stub, err := yaml.Marshal(yaml.MapSlice{{Key: locale, Value: nestedTranslations(stubsDefined[locale])}})
+			if err != nil {
+				return err
+			}
+			stubs[fmt.Sprintf(StubsLocaleFile, locale)] = stub
+		}
+	}
+	return nil
+}
+
+// templateKeys adds the keys given to the `t` and `plural` functions in a template node and its children to keys.
+// Plurals need at least the `other` form.
+func templateKeys(node parse.Node, keys map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateKeys(child, keys)
+		}
+	case *parse.ActionNode:
+		templateKeys(n.Pipe, keys)
+	case *parse.IfNode:
+		templateKeys(&n.BranchNode, keys)
+	case *parse.RangeNode:
+		templateKeys(&n.BranchNode, keys)
+	case *parse.WithNode:
+		templateKeys(&n.BranchNode, keys)
+	case *parse.BranchNode:
+		templateKeys(n.Pipe, keys)
+		templateKeys(n.List, keys)
+		templateKeys(n.ElseList, keys)
+	case *parse.TemplateNode:
+		templateKeys(n.Pipe, keys)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateKeys(cmd, keys)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) >= 3 {
+			ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+			key, isString := n.Args[2].(*parse.StringNode)
+			if isIdent && isString && ident.Ident == "t" {
+				keys[key.Text] = true
+			}
+			if isIdent && isString && ident.Ident == "plural" {
+				keys[key.Text+".other"] = true
+			}
+		}
+		for _, arg := range n.Args {
+			templateKeys(arg, keys)
+		}
+	}
+}
+
+// nestedTranslations turns translations whose keys are joined with dots, like `full_page.header.page`,
+// into a yml tree sorted by key.
+func nestedTranslations(translations map[string]string) yaml.MapSlice {
+	var keys []string
+	for key := range translations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var tree yaml.MapSlice
+	for _, key := range keys {
+		scopes := strings.Split(key, ".")
+		node := &tree
+		for _, scope := range scopes[:len(scopes)-1] {
+			var child *yaml.MapSlice
+			for i := range *node {
+				if sub, ok := (*node)[i].Value.(*yaml.MapSlice); ok && (*node)[i].Key == scope {
+					child = sub
+				}
+			}
+			if child == nil {
+				child = &yaml.MapSlice{}
+				*node = append(*node, yaml.MapItem{Key: scope, Value: child})
+			}
+			node = child
+		}
+		*node = append(*node, yaml.MapItem{Key: scopes[len(scopes)-1], Value: translations[key]})
+	}
+	return tree
+}
+
+// fallback tells whether the pages of a category missing from a locale fall back to their version in the default locale:
+// the fallback of the category in the locale, or else that of its closest parent, or else that of the website.
+func (cat *Category) fallback(siteinfo *Siteinfo, locale string) bool {
+	for ; cat != nil; cat = cat.Parent {
+		if fallback := cat.Locales[locale].Fallback; fallback != nil {
+			return *fallback
+		}
+	}
+	return siteinfo.Fallback
+}
+
+// addFallbackPages adds to the categories of tree whose fallback is set the untranslated versions of the pages
+// of the default locale missing from the other locales, unless their basename is already taken.
+// Added before tags, authors and the archive are built, they are listed there too, but feedPages leaves them out.
+// It returns the number of pages added in each locale.
+func addFallbackPages(tree *Category, siteinfo *Siteinfo) map[string]int {
+	counts := make(map[string]int)
+	defaultLocale := siteinfo.defaultLocale()
+	for catQueue := []*Category{tree}; len(catQueue) > 0; catQueue = append(catQueue[1:], catQueue[0].SubCategories...) {
+		cat := catQueue[0]
+		for locale, data := range cat.Locales {
+			if locale == defaultLocale || !cat.fallback(siteinfo, locale) {
+				continue
+			}
+		toNextPage:
+			for _, original := range cat.Locales[defaultLocale].Pages {
+				if original.Category != cat {
+					continue
+				}
+				for _, page := range data.Pages {
+					if page.ID == original.ID || page.Basename == original.Basename {
+						continue toNextPage
+					}
+				}
+				page := *original
+				page.Locale, page.Untranslated, page.Original = locale, true, original
+				data.Pages = append(data.Pages, &page)
+				counts[locale]++
+			}
+		}
+	}
+	return counts
+}
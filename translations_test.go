@@ -0,0 +1,77 @@
+// Tomato static website generator
+// Copyright Quentin Ribac, 2018
+// Free software license can be found in the LICENSE file.
+
+package tomato
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckTranslations(t *testing.T) {
+	input := fstest.MapFS{
+		"siteinfo.json":                  {Data: []byte(`{"locales": {"en": {"path": "/"}, "fr": {"path": "/fr"}}}`)},
+		"pages/catinfo.json":             {Data: []byte(`{"en": {"name": "Home"}, "fr": {"name": "Accueil"}}`)},
+		"pages/index.en.md":              {Data: []byte("# Home")},
+		"pages/index.fr.md":              {Data: []byte("# Accueil")},
+		"pages/00.post.en.md":            {Data: []byte("---\ntitle: Post\ndate: 2018-01-01\n---\nHello")},
+		"pages/01.billet.fr.md":          {Data: []byte("# Billet")},
+		"pages/02.stub.en.md":            {Data: []byte("# Stub")},
+		"pages/02.stub.fr.md":            {Data: []byte("---\ndraft: true\n---\n# Stub")},
+		"pages/03.wip.en.md":             {Data: []byte("---\ndraft: true\n---\n# Work in progress")},
+		"pages/blog/catinfo.json":        {Data: []byte(`{"name": "Blog"}`)},
+		"pages/news/catinfo.json":        {Data: []byte(`{"en": {"name": "News", "pageSize": 5}}`)},
+		"templates/page.html":            {Data: []byte(`{{ define "Header" }}{{ t .Locale "header.title" }}{{ plural .Locale "header.pages" 2 }}{{ end }}{{ define "Footer" }}{{ end }}{{ define "PageList" }}{{ end }}`)},
+		"templates/locales/en.yml":       {Data: []byte("en:\n    locale_name: English\n    header:\n        title: Title\n        pages:\n            one: page\n            other: pages\n")},
+		"templates/locales/fr.yml":       {Data: []byte("fr:\n    locale_name: Français\n    header:\n        pages:\n            other: pages\n    footer: Pied\n")},
+		"templates/locales/fr.stubs.yml": {Data: []byte("fr:\n    header:\n        title: Titre\n")},
+	}
+	report, err := CheckTranslations(context.Background(), Options{FS: input, Output: NewMapOutput()})
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+
+	want := []TranslationStatus{
+		{"en", 4, []string{"pages/01.billet.fr.md"}, 3, nil, 9, []string{"archive.page_list_name", "authors.page_list_name", "categories.page_list_name", "footer", "tags.page_list_name"}},
+		{"fr", 4, []string{"pages/00.post.en.md", "pages/02.stub.en.md"}, 3, []string{"pages/news/catinfo.json"}, 9, []string{"archive.page_list_name", "authors.page_list_name", "categories.page_list_name", "header.pages.one", "header.title", "tags.page_list_name"}},
+	}
+	if !reflect.DeepEqual(report.Locales, want) {
+		t.Errorf("got %+v; want %+v", report.Locales, want)
+	}
+
+	wantStubs := map[string]string{
+		"pages/01.billet.en.md":          "---\ndraft: true\n---\n\n# Billet",
+		"pages/00.post.fr.md":            "---\ntitle: Post\ndate: \"2018-01-01\"\ndraft: true\n---\n\nHello",
+		"pages/news/catinfo.stubs.json":  "{\n\t\"fr\": {\n\t\t\"name\": \"News\",\n\t\t\"pageSize\": 5\n\t}\n}\n",
+		"templates/locales/en.stubs.yml": "en:\n  archive:\n    page_list_name: \"\"\n  authors:\n    page_list_name: \"\"\n  categories:\n    page_list_name: \"\"\n  footer: Pied\n  tags:\n    page_list_name: \"\"\n",
+		"templates/locales/fr.stubs.yml": "fr:\n  archive:\n    page_list_name: \"\"\n  authors:\n    page_list_name: \"\"\n  categories:\n    page_list_name: \"\"\n  header:\n    pages:\n      one: page\n    title: Titre\n  tags:\n    page_list_name: \"\"\n",
+	}
+	if len(report.Stubs) != len(wantStubs) {
+		t.Errorf("got %v stubs; want %v", len(report.Stubs), len(wantStubs))
+	}
+	for name, want := range wantStubs {
+		if got := string(report.Stubs[name]); got != want {
+			t.Errorf("%v: got %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestLoadLocales_stubs(t *testing.T) {
+	input := fstest.MapFS{
+		"templates/locales/fr.yml":       {Data: []byte("fr:\n    footer: Pied\n")},
+		"templates/locales/fr.stubs.yml": {Data: []byte("fr:\n    header: Title\n")},
+	}
+	locales, err := LoadLocales(input, "templates/locales")
+	if err != nil {
+		t.Fatalf("got err = %v; want nil", err)
+	}
+	if got := string(locales.T("fr", "footer")); got != "Pied" {
+		t.Errorf("got footer = %q; want %q", got, "Pied")
+	}
+	if got := string(locales.T("fr", "header")); got == "Title" {
+		t.Errorf("got header = %q; want the stub left out", got)
+	}
+}